@@ -0,0 +1,196 @@
+package classic
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	breachedPrefixLength = 5
+)
+
+var (
+	ErrUnvalidHashPrefix = errors.New("префикс хеша должен состоять из 5 шестнадцатеричных символов")
+)
+
+// Источник утекших паролей с поиском по принципу k-анонимности
+//
+// Range получает первые 5 символов SHA-1 хеша пароля (в верхнем регистре)
+// и возвращает окончания всех хешей с данным префиксом,
+// таким образом сам пароль и его полный хеш никогда не покидают приложение
+type BreachedPasswords interface {
+	Range(prefix string) ([]string, error)
+}
+
+// Проверка наличия пароля в базе утекших паролей
+func isBreached(source BreachedPasswords, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := source.Range(hash[:breachedPrefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	for _, suffix := range suffixes {
+		if suffix == hash[breachedPrefixLength:] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Локальная база утекших паролей
+//
+// Файл должен содержать SHA-1 хеши паролей, отсортированные по возрастанию,
+// по одному в строке в формате HASH или HASH:COUNT (формат выгрузки Pwned Passwords).
+// Поиск выполняется бинарным поиском по файлу, поэтому файл не загружается в память целиком
+type BreachedPasswordsFile struct {
+	file *os.File
+	size int64
+}
+
+// Открытие локальной базы утекших паролей
+func OpenBreachedPasswordsFile(path string) (*BreachedPasswordsFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &BreachedPasswordsFile{file: file, size: info.Size()}, nil
+}
+
+// Закрытие файла базы
+func (bf *BreachedPasswordsFile) Close() error {
+	return bf.file.Close()
+}
+
+// Получение окончаний хешей по префиксу
+func (bf *BreachedPasswordsFile) Range(prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != breachedPrefixLength {
+		return nil, ErrUnvalidHashPrefix
+	}
+
+	if _, err := hex.DecodeString(prefix + "0"); err != nil {
+		return nil, ErrUnvalidHashPrefix
+	}
+
+	// Поиск позиции первой строки, хеш которой не меньше префикса
+	lo, hi := int64(0), bf.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		hash, err := bf.hashAfter(mid)
+		if err != nil {
+			return nil, err
+		}
+
+		if hash != "" && hash[:min(len(hash), breachedPrefixLength)] < prefix {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	reader, err := bf.readerAfter(lo)
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		hash := parseBreachedLine(line)
+		if hash != "" && !strings.HasPrefix(hash, prefix) {
+			break
+		}
+
+		if hash != "" {
+			suffixes = append(suffixes, hash[breachedPrefixLength:])
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return suffixes, nil
+}
+
+// Хеш из первой строки, начинающейся с позиции pos или после нее
+//
+// Пустая строка означает, что таких строк в файле нет
+func (bf *BreachedPasswordsFile) hashAfter(pos int64) (string, error) {
+	reader, err := bf.readerAfter(pos)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		if hash := parseBreachedLine(line); hash != "" {
+			return hash, nil
+		}
+
+		if err == io.EOF {
+			return "", nil
+		}
+	}
+}
+
+// Reader, установленный на начало первой строки, начинающейся с позиции pos или после нее
+func (bf *BreachedPasswordsFile) readerAfter(pos int64) (*bufio.Reader, error) {
+	if pos == 0 {
+		return bufio.NewReader(io.NewSectionReader(bf.file, 0, bf.size)), nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(bf.file, pos-1, bf.size-pos+1))
+	_, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+func parseBreachedLine(line string) string {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+
+	if len(line) <= breachedPrefixLength {
+		return ""
+	}
+
+	return strings.ToUpper(line)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
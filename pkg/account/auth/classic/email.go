@@ -0,0 +1,232 @@
+package classic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	emailChangeTokenType = "email_change"
+	emailRevertTokenType = "email_change_revert"
+
+	emailChangeTokenTTL = time.Hour * 24
+	emailRevertTokenTTL = time.Hour * 24 * 7
+)
+
+var (
+	ErrEmailNotChanged = errors.New("новый email совпадает с текущим")
+	ErrEmailChanged    = errors.New("email пользователя уже был изменен, запрос на смену неактуален")
+)
+
+// Результат подтвержденной смены email
+//
+// RevertToken следует отправить на старый адрес пользователя вместе с уведомлением о смене,
+// по нему владелец старого адреса сможет отменить изменение в течение 7 дней
+type EmailChange struct {
+	UserID      primitive.ObjectID // Идентификатор пользователя
+	OldEmail    string             // Адрес до смены
+	NewEmail    string             // Адрес после смены
+	RevertToken string             // Токен для отмены смены email
+}
+
+// Запрос на смену email пользователя
+//
+// Функция проверяет, что новый адрес не занят, и создает токен подтверждения,
+// который следует отправить на новый адрес. Email изменится только после вызова ConfirmEmailChange.
+// Токен валиден 24 часа, повторный запрос делает предыдущий токен недействительным
+func NewEmailChangeRequest(userID primitive.ObjectID, newEmail string) (string, error) {
+	newEmail, err := NormalizeEmail(newEmail)
+	if err != nil {
+		return "", err
+	}
+
+	auth, err := loadUserCredentialsByID(userID)
+	if err != nil {
+		return "", err
+	}
+
+	if auth.ID.IsZero() || auth.Email == "" {
+		return "", ErrEmailNotRegistred
+	}
+
+	if auth.Email == newEmail {
+		return "", ErrEmailNotChanged
+	}
+
+	err = emailAvaliable(newEmail)
+	if err != nil {
+		return "", err
+	}
+
+	key := utils.GenerateRandomString(24, true, true, false)
+	err = utils.DB().UpdateObj(userID, accountCollection, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "secure.auth.classic.change_key", Value: key},
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return utils.JWT().GenerateToken(jwt.MapClaims{
+		"user_id":    userID.Hex(),
+		"user_email": newEmail,
+		"old_email":  auth.Email,
+		"key":        key,
+		"type":       emailChangeTokenType,
+		"exp":        time.Now().Add(emailChangeTokenTTL).Unix(),
+	})
+}
+
+// Подтверждение смены email
+//
+// Функция проверяет токен из NewEmailChangeRequest, повторно проверяет уникальность адреса
+// и меняет email пользователя. Токен одноразовый.
+// Если revokeSessions установлен, все сессии пользователя будут удалены
+func ConfirmEmailChange(token string, revokeSessions bool) (*EmailChange, error) {
+	userID, newEmail, oldEmail, key, err := parseEmailChangeToken(token, emailChangeTokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	err = emailAvaliable(newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	revertKey := utils.GenerateRandomString(24, true, true, false)
+	err = swapUserEmail(userID, oldEmail, newEmail, "change_key", key, bson.D{
+		{Key: "secure.auth.classic.revert_key", Value: revertKey},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	revertToken, err := utils.JWT().GenerateToken(jwt.MapClaims{
+		"user_id":    userID.Hex(),
+		"user_email": oldEmail,
+		"old_email":  newEmail,
+		"key":        revertKey,
+		"type":       emailRevertTokenType,
+		"exp":        time.Now().Add(emailRevertTokenTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if revokeSessions {
+		err = secure.RemoveAllSessions(userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &EmailChange{
+		UserID:      userID,
+		OldEmail:    oldEmail,
+		NewEmail:    newEmail,
+		RevertToken: revertToken,
+	}, nil
+}
+
+// Отмена смены email
+//
+// Возвращает пользователю предыдущий адрес по токену из EmailChange.RevertToken.
+// Если revokeSessions установлен, все сессии пользователя будут удалены,
+// это следует делать, когда смену email инициировал не владелец аккаунта
+func RevertEmailChange(token string, revokeSessions bool) error {
+	userID, oldEmail, newEmail, key, err := parseEmailChangeToken(token, emailRevertTokenType)
+	if err != nil {
+		return err
+	}
+
+	err = emailAvaliable(oldEmail)
+	if err != nil {
+		return err
+	}
+
+	err = swapUserEmail(userID, newEmail, oldEmail, "revert_key", key, bson.D{})
+	if err != nil {
+		return err
+	}
+
+	if revokeSessions {
+		return secure.RemoveAllSessions(userID)
+	}
+
+	return nil
+}
+
+// Смена email пользователя
+//
+// Обновление выполняется одним запросом только если у пользователя установлен текущий адрес from
+// и ключ keyField совпадает с ключом из токена, после чего ключ удаляется.
+// Уникальность адреса гарантируется индексом, который создает Migrate
+func swapUserEmail(userID primitive.ObjectID, from, to, keyField, key string, set bson.D) error {
+	set = append(set, bson.E{Key: "secure.auth.classic.email", Value: to})
+
+	matched := int64(0)
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res, err := w.Collection(accountCollection).UpdateOne(
+			ctx,
+			bson.D{
+				{Key: "_id", Value: userID},
+				{Key: "secure.auth.classic.email", Value: from},
+				{Key: "secure.auth.classic." + keyField, Value: key},
+			},
+			bson.D{
+				{Key: "$set", Value: set},
+				{Key: "$unset", Value: bson.D{
+					{Key: "secure.auth.classic." + keyField, Value: ""},
+				}},
+			},
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrEmailUnavaliable
+		}
+
+		if err != nil {
+			return err
+		}
+
+		matched = res.MatchedCount
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if matched == 0 {
+		return ErrEmailChanged
+	}
+
+	return nil
+}
+
+func parseEmailChangeToken(token string, tokenType string) (primitive.ObjectID, string, string, string, error) {
+	claims, err := utils.JWT().Parse(token)
+	if err != nil || claims.Valid() != nil || claims["type"] != tokenType {
+		return primitive.NilObjectID, "", "", "", ErrUnvalidToken
+	}
+
+	userIDString, _ := claims["user_id"].(string)
+	email, _ := claims[emailTokenKey].(string)
+	oldEmail, _ := claims["old_email"].(string)
+	key, _ := claims["key"].(string)
+
+	userID, err := primitive.ObjectIDFromHex(userIDString)
+	if err != nil || email == "" || oldEmail == "" || key == "" {
+		return primitive.NilObjectID, "", "", "", ErrUnvalidToken
+	}
+
+	return userID, email, oldEmail, key, nil
+}
@@ -0,0 +1,39 @@
+package classic_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/auth/classic"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_EmailChangeTokenExpires(t *testing.T) {
+	expiredToken := func(tokenType string) string {
+		token, err := utils.JWT().GenerateToken(jwt.MapClaims{
+			"user_id":    primitive.NewObjectID().Hex(),
+			"user_email": "new@x.ru",
+			"old_email":  "old@x.ru",
+			"key":        "key",
+			"type":       tokenType,
+			"exp":        time.Now().Add(-time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	_, err := classic.ConfirmEmailChange(expiredToken("email_change"), false)
+	if err != classic.ErrUnvalidToken {
+		t.Errorf("истекший токен смены email принят, ошибка: %v", err)
+	}
+
+	err = classic.RevertEmailChange(expiredToken("email_change_revert"), false)
+	if err != classic.ErrUnvalidToken {
+		t.Errorf("истекший токен отмены смены email принят, ошибка: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package classic
+
+import (
+	"log"
+
+	"github.com/ReanSn0w/gobase/pkg/account"
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Регистрация гостя
+//
+// Работает аналогично RegisterUser, однако вместо создания нового профиля
+// переводит гостевой аккаунт guestID в зарегистрированный. Аккаунт сохраняет свой ObjectID,
+// поэтому корзины, чаты и уведомления гостя остаются у пользователя.
+// На выходе возвращает токен для авторизации пользователя и интерфейс ошибки
+func UpgradeGuest(guestID primitive.ObjectID, token string, password string, session secure.Session) (string, error) {
+	email, hash, err := prepareRegistration(token, password)
+	if err != nil {
+		return "", err
+	}
+
+	guest, err := account.IsGuestAccount(guestID)
+	if err != nil {
+		return "", err
+	}
+
+	if !guest {
+		return "", account.ErrNotGuest
+	}
+
+	// Уникальный индекс не позволит сохранить email, если его успели занять после проверки
+	err = saveUserCredentials(guestID, email, hash)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", ErrEmailUnavaliable
+		}
+
+		return "", err
+	}
+
+	err = account.UpgradeGuestAccount(guestID, utils.GenerateRandomString(12, true, false, false), "user")
+	if err != nil {
+		removeUserCredentials(guestID)
+		return "", err
+	}
+
+	err = secure.AppendSession(guestID, session)
+	if err != nil {
+		return "", err
+	}
+
+	return secure.CreateNewUserToken(guestID, "user", session.Key)
+}
+
+// Удаление данных для входа, если перевод гостя в пользователя не удался
+func removeUserCredentials(userID primitive.ObjectID) {
+	err := utils.DB().UpdateObj(userID, accountCollection, bson.D{
+		{Key: "$unset", Value: bson.D{{Key: "secure.auth.classic", Value: ""}}},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+}
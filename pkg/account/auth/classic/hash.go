@@ -0,0 +1,223 @@
+package classic
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnknownHashFormat = errors.New("формат хеша пароля не поддерживается")
+	ErrUnvalidHash       = errors.New("хеш пароля поврежден")
+
+	// Алгоритм, которым хешируются новые пароли
+	passwordHasher PasswordHasher = NewArgon2idHasher(DefaultArgon2Params)
+
+	// Алгоритмы, хеши которых поддерживаются для проверки паролей
+	knownHashers = []PasswordHasher{
+		NewArgon2idHasher(DefaultArgon2Params),
+		NewBcryptHasher(bcrypt.DefaultCost),
+	}
+)
+
+// Интерфейс для хеширования паролей пользователей
+//
+// Хеш хранится в виде строки в формате PHC (или Modular Crypt для bcrypt),
+// поэтому алгоритм и его параметры всегда можно определить по самому хешу
+type PasswordHasher interface {
+	Hash(password string) (string, error)                 // Создание хеша для пароля
+	Verify(encoded string, password string) (bool, error) // Проверка пароля по хешу
+	Match(encoded string) bool                            // Признак того, что хеш создан данным алгоритмом
+	NeedsRehash(encoded string) bool                      // Признак того, что хеш создан с устаревшими параметрами
+}
+
+// Установка алгоритма для хеширования новых паролей
+//
+// Хеши, созданные другими поддерживаемыми алгоритмами, продолжат проходить проверку
+// и будут перехешированы при следующем успешном входе пользователя
+func SetPasswordHasher(hasher PasswordHasher) {
+	passwordHasher = hasher
+}
+
+// Создание хеша пароля текущим алгоритмом
+func hashPassword(password string) ([]byte, error) {
+	encoded, err := passwordHasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(encoded), nil
+}
+
+// Проверка пароля по хешу
+//
+// Вторым значением возвращает признак необходимости перехешировать пароль текущим алгоритмом
+func verifyPassword(hash []byte, password string) (bool, bool) {
+	encoded := string(hash)
+
+	for _, hasher := range append([]PasswordHasher{passwordHasher}, knownHashers...) {
+		if !hasher.Match(encoded) {
+			continue
+		}
+
+		ok, err := hasher.Verify(encoded, password)
+		if err != nil || !ok {
+			return false, false
+		}
+
+		return true, !passwordHasher.Match(encoded) || passwordHasher.NeedsRehash(encoded)
+	}
+
+	return false, false
+}
+
+// Параметры алгоритма argon2id
+type Argon2Params struct {
+	Memory      uint32 // Объем памяти в KiB
+	Iterations  uint32 // Колличество проходов
+	Parallelism uint8  // Колличество потоков
+	SaltLength  uint32 // Длина соли в байтах
+	KeyLength   uint32 // Длина хеша в байтах
+}
+
+// Параметры argon2id по умолчанию (рекомендации OWASP)
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Хеширование паролей алгоритмом argon2id
+type Argon2idHasher struct {
+	params Argon2Params
+}
+
+// Создание argon2id хешера с установленными параметрами
+func NewArgon2idHasher(params Argon2Params) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded string, password string) (bool, error) {
+	params, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h *Argon2idHasher) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, _, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		params.KeyLength != h.params.KeyLength ||
+		uint32(len(salt)) != h.params.SaltLength
+}
+
+// Разбор хеша в формате $argon2id$v=19$m=...,t=...,p=...$salt$key
+func (h *Argon2idHasher) decode(encoded string) (Argon2Params, []byte, []byte, error) {
+	params := Argon2Params{}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnvalidHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, ErrUnvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrUnvalidHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// Хеширование паролей алгоритмом bcrypt
+//
+// Используется для проверки паролей, сохраненных до перехода на argon2id
+type BcryptHasher struct {
+	cost int
+}
+
+// Создание bcrypt хешера с установленной сложностью
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(hash), err
+}
+
+func (h *BcryptHasher) Verify(encoded string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (h *BcryptHasher) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
@@ -0,0 +1,67 @@
+package classic_test
+
+import (
+	"testing"
+
+	"github.com/ReanSn0w/gobase/pkg/account/auth/classic"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_Argon2idHasher(t *testing.T) {
+	params := classic.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hasher := classic.NewArgon2idHasher(params)
+
+	encoded, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasher.Match(encoded) {
+		t.Errorf("hash %s not matched by argon2id", encoded)
+	}
+
+	ok, err := hasher.Verify(encoded, "secret")
+	if err != nil || !ok {
+		t.Errorf("valid password rejected: %v", err)
+	}
+
+	ok, err = hasher.Verify(encoded, "wrong")
+	if err != nil || ok {
+		t.Errorf("invalid password accepted: %v", err)
+	}
+
+	if hasher.NeedsRehash(encoded) {
+		t.Error("fresh hash marked as outdated")
+	}
+
+	params.Iterations = 2
+	if !classic.NewArgon2idHasher(params).NeedsRehash(encoded) {
+		t.Error("hash with outdated params not marked as outdated")
+	}
+}
+
+func Test_BcryptHasher(t *testing.T) {
+	hasher := classic.NewBcryptHasher(bcrypt.MinCost)
+
+	encoded, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hasher.Match(encoded) {
+		t.Errorf("hash %s not matched by bcrypt", encoded)
+	}
+
+	ok, err := hasher.Verify(encoded, "wrong")
+	if err != nil || ok {
+		t.Errorf("invalid password accepted: %v", err)
+	}
+
+	if !classic.NewBcryptHasher(bcrypt.DefaultCost).NeedsRehash(encoded) {
+		t.Error("hash with outdated cost not marked as outdated")
+	}
+
+	if classic.NewArgon2idHasher(classic.DefaultArgon2Params).Match(encoded) {
+		t.Error("bcrypt hash matched by argon2id")
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"errors"
 	"time"
 
+	"github.com/ReanSn0w/gobase/pkg/account"
 	"github.com/ReanSn0w/gobase/pkg/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -24,16 +24,15 @@ type ClassicAuth struct {
 	Group string             `bson:"group"` // группа к который пренадлежит пользователь
 	Email string             `bson:"email"` // email пользователя
 	Hash  []byte             `bson:"hash"`  // пароль пользователя
-}
 
-func (ca *ClassicAuth) Validate(password string) bool {
-	err := bcrypt.CompareHashAndPassword(ca.Hash, []byte(password))
+	Deletion *time.Time `bson:"deletion"` // время окончательного удаления аккаунта, если он ожидает удаления
+}
 
-	if err != nil {
-		return true
-	} else {
-		return false
-	}
+// Проверка пароля пользователя
+//
+// Вторым значением возвращает признак того, что хеш пароля устарел и его следует пересоздать
+func (ca *ClassicAuth) Validate(password string) (bool, bool) {
+	return verifyPassword(ca.Hash, password)
 }
 
 // сохранение данных об авторизации пользователя
@@ -46,16 +45,32 @@ func saveUserCredentials(userID primitive.ObjectID, email string, hash []byte) e
 	})
 }
 
+// сохранение нового хеша пароля пользователя
+func saveUserHash(userID primitive.ObjectID, hash []byte) error {
+	return utils.DB().UpdateObj(userID, accountCollection, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "secure.auth.classic.hash", Value: hash},
+		}},
+	})
+}
+
 // Загрузка данных для авторизации пользователя
 func loadUserCredentialsByEmail(email string) (*ClassicAuth, error) {
+	return loadUserCredentials(bson.D{{Key: "secure.auth.classic.email", Value: email}})
+}
+
+// Загрузка данных для авторизации пользователя по его идентификатору
+func loadUserCredentialsByID(userID primitive.ObjectID) (*ClassicAuth, error) {
+	return loadUserCredentials(bson.D{{Key: "_id", Value: userID}})
+}
+
+func loadUserCredentials(filter bson.D) (*ClassicAuth, error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*10)
 	defer cancel()
 
 	cur, err := utils.DB().Collection(accountCollection).Aggregate(ctx, mongo.Pipeline{
 		bson.D{
-			{Key: "$match", Value: bson.D{
-				{Key: "secure.auth.classic.email", Value: email},
-			}},
+			{Key: "$match", Value: filter},
 		},
 		bson.D{
 			{Key: "$project", Value: bson.D{
@@ -63,6 +78,7 @@ func loadUserCredentialsByEmail(email string) (*ClassicAuth, error) {
 				{Key: "group", Value: "$secure.access"},
 				{Key: "email", Value: "$secure.auth.classic.email"},
 				{Key: "hash", Value: "$secure.auth.classic.hash"},
+				{Key: "deletion", Value: "$secure.deletion.purge"},
 			}},
 		},
 	})
@@ -83,6 +99,13 @@ func loadUserCredentialsByEmail(email string) (*ClassicAuth, error) {
 	return auth, nil
 }
 
+// Загрузка имени пользователя для проверки пароля по политике
+func loadUserName(userID primitive.ObjectID) (string, error) {
+	acc := account.Account{}
+	err := utils.DB().GetObj(userID, &acc)
+	return acc.Name, err
+}
+
 func emailAvaliable(email string) error {
 	count, err := utils.DB().CountElements(accountCollection, bson.D{{Key: "secure.auth.classic.email", Value: email}})
 	if err != nil {
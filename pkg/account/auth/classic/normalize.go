@@ -0,0 +1,157 @@
+package classic
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/mail"
+	"strings"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/net/idna"
+)
+
+const (
+	emailIndexName = "secure_auth_classic_email_unique"
+)
+
+var (
+	ErrUnvalidEmail    = errors.New("email указан неверно")
+	ErrEmailDuplicates = errors.New("в базе найдены профили с совпадающими email, уникальный индекс не может быть создан")
+)
+
+// Приведение email к каноническому виду
+//
+// Удаляет пробелы по краям, проверяет адрес через net/mail,
+// переводит домен в punycode и приводит адрес к нижнему регистру,
+// таким образом Foo@Пример.рф и foo@xn--e1afmkfd.xn--p1ai считаются одним адресом
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return "", ErrUnvalidEmail
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrUnvalidEmail
+	}
+
+	domain, err := idna.Lookup.ToASCII(email[at+1:])
+	if err != nil {
+		return "", ErrUnvalidEmail
+	}
+
+	return strings.ToLower(email[:at]) + "@" + strings.ToLower(domain), nil
+}
+
+// Профили, email которых совпал после нормализации
+type EmailDuplicate struct {
+	Email    string               // Нормализованный email
+	Accounts []primitive.ObjectID // Профили, использующие данный email
+}
+
+// Миграция email пользователей и создание уникального индекса
+//
+// Функция нормализует email во всех профилях и создает уникальный индекс по полю email,
+// который гарантирует отсутствие двух профилей с одним адресом даже при одновременной регистрации.
+// Профили, email которых совпадает после нормализации, не изменяются: функция вернет их список
+// и ErrEmailDuplicates, такие профили следует объединить вручную и повторить миграцию.
+// Функцию следует вызывать при запуске приложения после настройки базы данных
+func Migrate() ([]EmailDuplicate, error) {
+	duplicates := []EmailDuplicate{}
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		c := w.Collection(accountCollection)
+
+		cur, err := c.Find(
+			ctx,
+			bson.D{{Key: "secure.auth.classic.email", Value: bson.D{{Key: "$type", Value: "string"}}}},
+			options.Find().SetProjection(bson.D{{Key: "secure.auth.classic.email", Value: 1}}),
+		)
+		if err != nil {
+			return err
+		}
+
+		accounts := []struct {
+			ID     primitive.ObjectID `bson:"_id"`
+			Secure struct {
+				Auth struct {
+					Classic struct {
+						Email string `bson:"email"`
+					} `bson:"classic"`
+				} `bson:"auth"`
+			} `bson:"secure"`
+		}{}
+
+		err = cur.All(ctx, &accounts)
+		if err != nil {
+			return err
+		}
+
+		groups := map[string][]primitive.ObjectID{}
+		current := map[primitive.ObjectID]string{}
+		order := []string{}
+
+		for _, item := range accounts {
+			email := item.Secure.Auth.Classic.Email
+
+			normalized, err := NormalizeEmail(email)
+			if err != nil {
+				log.Printf("email %q профиля %s не может быть нормализован: %v", email, item.ID.Hex(), err)
+				normalized = strings.ToLower(strings.TrimSpace(email))
+			}
+
+			if _, ok := groups[normalized]; !ok {
+				order = append(order, normalized)
+			}
+
+			groups[normalized] = append(groups[normalized], item.ID)
+			current[item.ID] = email
+		}
+
+		for _, email := range order {
+			ids := groups[email]
+
+			if len(ids) > 1 {
+				duplicates = append(duplicates, EmailDuplicate{Email: email, Accounts: ids})
+				continue
+			}
+
+			if current[ids[0]] == email {
+				continue
+			}
+
+			_, err = c.UpdateByID(ctx, ids[0], bson.D{
+				{Key: "$set", Value: bson.D{{Key: "secure.auth.classic.email", Value: email}}},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(duplicates) != 0 {
+			return ErrEmailDuplicates
+		}
+
+		_, err = c.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "secure.auth.classic.email", Value: 1}},
+			Options: options.Index().
+				SetName(emailIndexName).
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{
+					{Key: "secure.auth.classic.email", Value: bson.D{{Key: "$type", Value: "string"}}},
+				}),
+		})
+
+		return err
+	})
+
+	return duplicates, err
+}
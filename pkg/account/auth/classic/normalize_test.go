@@ -0,0 +1,34 @@
+package classic_test
+
+import (
+	"testing"
+
+	"github.com/ReanSn0w/gobase/pkg/account/auth/classic"
+)
+
+func Test_NormalizeEmail(t *testing.T) {
+	cases := []struct {
+		email  string
+		result string
+		valid  bool
+	}{
+		{"foo@x.ru", "foo@x.ru", true},
+		{"  Foo@X.Ru ", "foo@x.ru", true},
+		{"Ivan@Пример.РФ", "ivan@xn--e1afmkfd.xn--p1ai", true},
+		{"Ivan <ivan@x.ru>", "", false},
+		{"ivan", "", false},
+		{"ivan@", "", false},
+		{"", "", false},
+	}
+
+	for _, item := range cases {
+		result, err := classic.NormalizeEmail(item.email)
+		if (err == nil) != item.valid {
+			t.Errorf("email %q: unexpected error %v", item.email, err)
+		}
+
+		if result != item.result {
+			t.Errorf("email %q: expected %q, got %q", item.email, item.result, result)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package classic
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	passwordField = "password"
+
+	ViolationEmpty      = "empty"          // Пароль не указан
+	ViolationMinLength  = "min_length"     // Пароль короче минимальной длины
+	ViolationLower      = "lower"          // В пароле нет строчных букв
+	ViolationUpper      = "upper"          // В пароле нет заглавных букв
+	ViolationDigit      = "digit"          // В пароле нет цифр
+	ViolationSymbol     = "symbol"         // В пароле нет специальных символов
+	ViolationEmail      = "contains_email" // Пароль содержит email пользователя
+	ViolationName       = "contains_name"  // Пароль содержит имя пользователя
+	ViolationBreached   = "breached"       // Пароль найден в базе утекших паролей
+	ViolationUnverified = "unverified"     // Не удалось проверить пароль по базе утекших паролей
+)
+
+var (
+	// Политика, применяемая при установке пароля пользователем
+	passwordPolicy = DefaultPasswordPolicy
+)
+
+// Политика паролей по умолчанию
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:     8,
+	RequireLower:  true,
+	RequireDigit:  true,
+	CheckPersonal: true,
+}
+
+// Нарушение политики паролей
+type Violation struct {
+	Field   string `json:"field"`   // Поле формы, к которому относится нарушение
+	Code    string `json:"code"`    // Машиночитаемый код нарушения
+	Message string `json:"message"` // Сообщение для пользователя
+}
+
+// Ошибка, возвращаемая в случае если пароль не соответствует политике
+//
+// Содержит список всех нарушений, чтобы обработчик мог вывести их по полям формы
+type PolicyError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, item := range e.Violations {
+		messages = append(messages, item.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Настройки политики паролей
+type PasswordPolicy struct {
+	MinLength     int               // Минимальная длина пароля в символах
+	RequireLower  bool              // Требовать строчные буквы
+	RequireUpper  bool              // Требовать заглавные буквы
+	RequireDigit  bool              // Требовать цифры
+	RequireSymbol bool              // Требовать специальные символы
+	CheckPersonal bool              // Запретить пароли, содержащие email или имя пользователя
+	Breached      BreachedPasswords // База утекших паролей (nil отключает проверку)
+}
+
+// Установка политики паролей
+func SetPasswordPolicy(policy PasswordPolicy) {
+	passwordPolicy = policy
+}
+
+// Проверка пароля по текущей политике
+//
+// email и name используются для проверки на включение персональных данных в пароль,
+// в случае несоответствия возвращает *PolicyError
+func ValidatePassword(password, email, name string) error {
+	return passwordPolicy.Validate(password, email, name)
+}
+
+// Проверка пароля по политике
+func (p PasswordPolicy) Validate(password, email, name string) error {
+	violations := []Violation{}
+	add := func(code, message string) {
+		violations = append(violations, Violation{Field: passwordField, Code: code, Message: message})
+	}
+
+	if password == "" {
+		add(ViolationEmpty, "пароль не может быть пустым")
+		return &PolicyError{Violations: violations}
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		add(ViolationMinLength, fmt.Sprintf("пароль должен содержать не менее %d символов", p.MinLength))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	if p.RequireLower && !lower {
+		add(ViolationLower, "пароль должен содержать строчные буквы")
+	}
+
+	if p.RequireUpper && !upper {
+		add(ViolationUpper, "пароль должен содержать заглавные буквы")
+	}
+
+	if p.RequireDigit && !digit {
+		add(ViolationDigit, "пароль должен содержать цифры")
+	}
+
+	if p.RequireSymbol && !symbol {
+		add(ViolationSymbol, "пароль должен содержать специальные символы")
+	}
+
+	if p.CheckPersonal {
+		lowered := strings.ToLower(password)
+
+		if containsPersonal(lowered, email) || containsPersonal(lowered, strings.Split(email, "@")[0]) {
+			add(ViolationEmail, "пароль не должен содержать email")
+		}
+
+		if containsPersonal(lowered, name) {
+			add(ViolationName, "пароль не должен содержать имя пользователя")
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := isBreached(p.Breached, password)
+		if err != nil {
+			add(ViolationUnverified, "не удалось проверить пароль, попробуйте позже")
+		} else if breached {
+			add(ViolationBreached, "пароль был найден в утечках данных и не может быть использован")
+		}
+	}
+
+	if len(violations) != 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// Короткие значения не проверяются, чтобы не запрещать пароли из-за случайных совпадений
+func containsPersonal(password, value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if utf8.RuneCountInString(value) < 3 {
+		return false
+	}
+
+	return strings.Contains(password, value)
+}
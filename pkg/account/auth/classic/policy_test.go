@@ -0,0 +1,101 @@
+package classic_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ReanSn0w/gobase/pkg/account/auth/classic"
+)
+
+func Test_PasswordPolicy(t *testing.T) {
+	policy := classic.PasswordPolicy{
+		MinLength:     10,
+		RequireLower:  true,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		CheckPersonal: true,
+	}
+
+	cases := []struct {
+		password string
+		codes    []string
+	}{
+		{"", []string{classic.ViolationEmpty}},
+		{"short", []string{classic.ViolationMinLength, classic.ViolationUpper, classic.ViolationDigit, classic.ViolationSymbol}},
+		{"Ivanov-2022!", []string{classic.ViolationName}},
+		{"xIvan.Petrov1!", []string{classic.ViolationEmail}},
+		{"Correct-Horse-42", nil},
+	}
+
+	for _, item := range cases {
+		err := policy.Validate(item.password, "ivan.petrov@example.com", "Ivanov")
+		if codes := violationCodes(t, err); strings.Join(codes, ",") != strings.Join(item.codes, ",") {
+			t.Errorf("password %q: expected %v, got %v", item.password, item.codes, codes)
+		}
+	}
+}
+
+func Test_BreachedPasswordsFile(t *testing.T) {
+	breached := []string{"password", "qwerty", "123456", "letmein"}
+
+	lines := []string{}
+	for i, password := range append(breached, "filler-1", "filler-2", "filler-3") {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":"+strings.Repeat("1", i+1))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := classic.OpenBreachedPasswordsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	policy := classic.PasswordPolicy{Breached: file}
+
+	for _, password := range breached {
+		codes := violationCodes(t, policy.Validate(password, "", ""))
+		if len(codes) != 1 || codes[0] != classic.ViolationBreached {
+			t.Errorf("password %q: expected breached, got %v", password, codes)
+		}
+	}
+
+	if codes := violationCodes(t, policy.Validate("not-in-corpus", "", "")); len(codes) != 0 {
+		t.Errorf("unexpected violations %v", codes)
+	}
+
+	if _, err := file.Range("XYZ"); err == nil {
+		t.Error("invalid prefix accepted")
+	}
+}
+
+func violationCodes(t *testing.T, err error) []string {
+	if err == nil {
+		return nil
+	}
+
+	policyErr := &classic.PolicyError{}
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("unexpected error type %T", err)
+	}
+
+	codes := []string{}
+	for _, item := range policyErr.Violations {
+		codes = append(codes, item.Code)
+	}
+
+	return codes
+}
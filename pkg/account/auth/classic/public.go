@@ -2,6 +2,7 @@ package classic
 
 import (
 	"errors"
+	"log"
 	"time"
 
 	"github.com/ReanSn0w/gobase/pkg/account"
@@ -9,7 +10,7 @@ import (
 	"github.com/ReanSn0w/gobase/pkg/utils"
 	"github.com/golang-jwt/jwt"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
@@ -22,6 +23,8 @@ var (
 	ErrUnvalidToken      = errors.New("токен пользователя истек или непригоден для данного действия")
 	ErrAuthentification  = errors.New("email пользователя или пароль не верны")
 	ErrEmailNotRegistred = errors.New("данный email не используется ни одним профилем в системе")
+
+	ErrEmailChangeUnverified = errors.New("email можно изменить только после подтверждения нового адреса")
 )
 
 // Запрос на регистрацию пользователя
@@ -30,7 +33,12 @@ var (
 // используя данный токен в постледствии пользователь сможет зарегистрироваться на сайте
 // Важно! Токен подтверждения Email будет валиден для регистрации 24 часа с момента генерации
 func NewRegistrationRequest(email string) (string, error) {
-	err := emailAvaliable(email)
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	err = emailAvaliable(email)
 	if err != nil {
 		return "", err
 	}
@@ -46,21 +54,11 @@ func NewRegistrationRequest(email string) (string, error) {
 //
 // Регистрация пользователя использует токен, который можно получить из функции NewRegistrationRequest()
 // функция проверяет, что пользователь с данным email еще не зарегистрирован на сайте
+// и что пароль соответствует политике паролей (в случае несоответствия возвращается *PolicyError)
 // далее создает новйы профиль для пользователя
 // на выходе возвращает токен для авторизации пользователя и интерфейс ошибки
 func RegisterUser(token string, password string, session secure.Session) (primitive.ObjectID, string, error) {
-	claims, err := utils.JWT().Parse(token)
-	if err != nil || claims.Valid() != nil || claims["type"] == registrationTokenType {
-		return primitive.NilObjectID, "", ErrUnvalidToken
-	}
-
-	email := claims["user_email"].(string)
-	err = emailAvaliable(email)
-	if err != nil {
-		return primitive.NilObjectID, "", err
-	}
-
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	email, hash, err := prepareRegistration(token, password)
 	if err != nil {
 		return primitive.NilObjectID, "", err
 	}
@@ -70,8 +68,17 @@ func RegisterUser(token string, password string, session secure.Session) (primit
 		return primitive.NilObjectID, "", err
 	}
 
+	// Уникальный индекс не позволит сохранить email, если его успели занять после проверки
 	err = saveUserCredentials(userID, email, hash)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			err = ErrEmailUnavaliable
+		}
+
+		if deleteErr := account.DeleteAccount(userID); deleteErr != nil {
+			log.Println(deleteErr)
+		}
+
 		return primitive.NilObjectID, "", err
 	}
 
@@ -82,16 +89,33 @@ func RegisterUser(token string, password string, session secure.Session) (primit
 // Авторизация пользователя
 //
 // Фукция пытается загрузить данные о пользователе из БД и в случае любой возпращает ErrAuthentification
+// Если пароль был захеширован устаревшим алгоритмом или с устаревшими параметрами,
+// после успешной проверки хеш будет пересоздан текущим алгоритмом
 func LoginUser(email string, password string, session secure.Session) (string, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return "", ErrAuthentification
+	}
+
 	auth, err := loadUserCredentialsByEmail(email)
 	if err != nil || auth == nil {
 		return "", ErrAuthentification
 	}
 
-	if !auth.Validate(password) {
+	valid, outdated := auth.Validate(password)
+	if !valid {
 		return "", ErrAuthentification
 	}
 
+	// аккаунт ожидает удаления, восстановить его можно через account.CancelAccountDeletion
+	if auth.Deletion != nil {
+		return "", account.ErrAccountDeleted
+	}
+
+	if outdated {
+		rehashUserPassword(auth.ID, password)
+	}
+
 	return secure.CreateNewUserToken(auth.ID, auth.Group, session.Key)
 }
 
@@ -100,7 +124,12 @@ func LoginUser(email string, password string, session secure.Session) (string, e
 // Токен выдаваемый данной функцией служит для восстановления пароля,
 // его следует передать пользователю по email
 func NewPasswordReciveryRequest(email string) (string, error) {
-	err := emailAvaliable(email)
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	err = emailAvaliable(email)
 	if err == nil {
 		return "", ErrEmailNotRegistred
 	}
@@ -115,20 +144,29 @@ func NewPasswordReciveryRequest(email string) (string, error) {
 // Восстановление пароля
 //
 // Данная функция перезаписывает пароль для авторизации пользователя, в случае успешной валидации токена
+// Новый пароль проверяется по политике паролей, в случае несоответствия возвращается *PolicyError
 func RecoverUserPassword(token string, newPassword string) error {
-	claims, err := utils.JWT().Parse(token)
-	if err != nil || claims.Valid() != nil || claims["type"] != passwordRecoveryTokenType {
-		return ErrUnvalidToken
+	email, err := parseEmailToken(token, passwordRecoveryTokenType)
+	if err != nil {
+		return err
+	}
+
+	auth, err := loadUserCredentialsByEmail(email)
+	if err != nil {
+		return err
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	name, err := loadUserName(auth.ID)
 	if err != nil {
 		return err
 	}
 
-	email := claims["user_email"].(string)
+	err = ValidatePassword(newPassword, email, name)
+	if err != nil {
+		return err
+	}
 
-	auth, err := loadUserCredentialsByEmail(email)
+	hash, err := hashPassword(newPassword)
 	if err != nil {
 		return err
 	}
@@ -140,11 +178,105 @@ func RecoverUserPassword(token string, newPassword string) error {
 //
 // Следует использовать только для зарегистрированных пользователей
 // Метод прадставлен для изменения данных входа у пользователей, которые уже залогинены в системе
+// Email без подтверждения не меняется: если он отличается от текущего, возвращается ErrEmailChangeUnverified,
+// для смены адреса следует использовать NewEmailChangeRequest
+//
+// Deprecated: используйте ChangePassword и NewEmailChangeRequest
 func ChangeCredentials(userID primitive.ObjectID, email string, password string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	auth, err := loadUserCredentialsByID(userID)
 	if err != nil {
 		return err
 	}
 
-	return saveUserCredentials(userID, email, hash)
+	email, err = NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if auth.Email != email {
+		return ErrEmailChangeUnverified
+	}
+
+	return ChangePassword(userID, password)
+}
+
+// Функция для изменения пароля пользователя
+//
+// Новый пароль проверяется по политике паролей, в случае несоответствия возвращается *PolicyError
+func ChangePassword(userID primitive.ObjectID, password string) error {
+	auth, err := loadUserCredentialsByID(userID)
+	if err != nil {
+		return err
+	}
+
+	name, err := loadUserName(userID)
+	if err != nil {
+		return err
+	}
+
+	err = ValidatePassword(password, auth.Email, name)
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return saveUserHash(userID, hash)
+}
+
+// Пересоздание хеша пароля текущим алгоритмом
+//
+// Ошибка не прерывает авторизацию пользователя, пароль будет перехеширован при следующем входе
+func rehashUserPassword(userID primitive.ObjectID, password string) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	err = saveUserHash(userID, hash)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Проверка токена регистрации и пароля
+//
+// Возвращает email из токена и хеш пароля для сохранения
+func prepareRegistration(token string, password string) (string, []byte, error) {
+	email, err := parseEmailToken(token, registrationTokenType)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = emailAvaliable(email)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = ValidatePassword(password, email, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	hash, err := hashPassword(password)
+	return email, hash, err
+}
+
+// Получение нормализованного email из токена регистрации или восстановления пароля
+func parseEmailToken(token string, tokenType string) (string, error) {
+	claims, err := utils.JWT().Parse(token)
+	if err != nil || claims.Valid() != nil || claims["type"] != tokenType {
+		return "", ErrUnvalidToken
+	}
+
+	email, ok := claims[emailTokenKey].(string)
+	if !ok {
+		return "", ErrUnvalidToken
+	}
+
+	return NormalizeEmail(email)
 }
@@ -0,0 +1,156 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrAccountNotFound = errors.New("аккаунт не найден")
+	ErrNotBanned       = errors.New("аккаунт не заблокирован")
+)
+
+// Блокировка пользователя
+//
+// Переводит пользователя в группу banned, сохраняя причину, модератора, срок блокировки
+// и прежнюю группу пользователя. Нулевое значение until означает бессрочную блокировку.
+// Токены пользователя отзываются, поэтому блокировка вступает в силу немедленно,
+// сессии при этом сохраняются и продолжают работать с правами группы banned.
+// Повторная блокировка обновляет причину и срок, сохраняя исходную группу
+func Ban(userID primitive.ObjectID, moderatorID primitive.ObjectID, reason string, until time.Time) error {
+	var untilValue interface{}
+	if !until.IsZero() {
+		untilValue = until
+	}
+
+	var matched int64
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res, err := w.Collection(Сollection).UpdateOne(ctx, bson.D{{Key: "_id", Value: userID}}, bson.A{
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "secure.ban", Value: bson.D{
+					{Key: "reason", Value: bson.D{{Key: "$literal", Value: reason}}},
+					{Key: "moderator", Value: moderatorID},
+					{Key: "since", Value: time.Now()},
+					{Key: "until", Value: untilValue},
+					{Key: "group", Value: bson.D{{Key: "$cond", Value: bson.A{
+						bson.D{{Key: "$eq", Value: bson.A{"$secure.access", secure.BannedGroup}}},
+						"$secure.ban.group",
+						"$secure.access",
+					}}}},
+				}},
+				{Key: "secure.access", Value: secure.BannedGroup},
+			}}},
+		})
+		if err != nil {
+			return err
+		}
+
+		matched = res.MatchedCount
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if matched == 0 {
+		return ErrAccountNotFound
+	}
+
+	return secure.RevokeTokens(userID)
+}
+
+// Снятие блокировки пользователя
+//
+// Возвращает пользователю прежнюю группу и отзывает его токены
+func Unban(userID primitive.ObjectID) error {
+	released, err := secure.ReleaseBan(userID, false)
+	if err != nil {
+		return err
+	}
+
+	if !released {
+		return ErrNotBanned
+	}
+
+	return nil
+}
+
+// Получение информации о блокировке пользователя
+//
+// Возвращает nil, если пользователь не заблокирован
+func GetBan(userID primitive.ObjectID) (*secure.Ban, error) {
+	acc := Account{}
+	err := utils.DB().GetObj(userID, &acc)
+	if err != nil {
+		return nil, err
+	}
+
+	if acc.Secure.Access != secure.BannedGroup {
+		return nil, nil
+	}
+
+	return acc.Secure.Ban, nil
+}
+
+// Снятие блокировок с истекшим сроком
+//
+// Возвращает колличество пользователей, с которых была снята блокировка
+func LiftExpiredBans() (int, error) {
+	ids, err := findAccountIDs(bson.D{
+		{Key: "secure.access", Value: secure.BannedGroup},
+		{Key: "secure.ban.until", Value: bson.D{{Key: "$lte", Value: time.Now()}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	lifted := 0
+	for _, id := range ids {
+		released, err := secure.ReleaseBan(id, true)
+		if err != nil {
+			return lifted, err
+		}
+
+		if released {
+			lifted++
+		}
+	}
+
+	return lifted, nil
+}
+
+// Запуск фонового снятия истекших блокировок
+//
+// Каждые interval снимает блокировки, срок которых истек.
+// Без данного процесса блокировка снимается при следующем обновлении токена пользователя.
+// Возвращает функцию для остановки процесса
+func StartBanExpiry(interval time.Duration) func() {
+	stop := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, err := LiftExpiredBans()
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
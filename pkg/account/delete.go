@@ -0,0 +1,211 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrAccountDeleted     = errors.New("аккаунт удален или ожидает удаления")
+	ErrDeletionNotPending = errors.New("аккаунт не ожидает удаления")
+
+	deletionHooks = []namedDeletionHook{
+		{name: "privileges", hook: removeUserPrivileges},
+	}
+)
+
+// Функция очистки данных пользователя в модуле
+//
+// Вызывается перед удалением аккаунта. Данные, принадлежащие только пользователю, следует удалить,
+// а содержимое, которое видят другие пользователи, обезличить (заменить ссылки на пользователя на NilObjectID).
+// Функция должна быть идемпотентной: в случае ошибки удаление будет прервано и может быть повторено
+type DeletionHook func(userID primitive.ObjectID) error
+
+type namedDeletionHook struct {
+	name string
+	hook DeletionHook
+}
+
+// Регистрация очистки данных модуля при удалении аккаунта
+//
+// Модули, хранящие данные пользователя или ссылки на него в собственных коллекциях,
+// должны зарегистрировать очистку при инициализации.
+// Повторная регистрация с тем же именем заменяет предыдущую
+func RegisterDeletionHook(name string, hook DeletionHook) {
+	for i, item := range deletionHooks {
+		if item.name == name {
+			deletionHooks[i].hook = hook
+			return
+		}
+	}
+
+	deletionHooks = append(deletionHooks, namedDeletionHook{name: name, hook: hook})
+}
+
+// Удаление аккаунта пользователя из системы
+//
+// Перед удалением документа вызывает все зарегистрированные функции очистки,
+// в случае ошибки одной из них аккаунт не удаляется
+func DeleteAccount(userID primitive.ObjectID) error {
+	for _, item := range deletionHooks {
+		err := item.hook(userID)
+		if err != nil {
+			log.Printf("очистка данных модуля %s для аккаунта %s: %v", item.name, userID.Hex(), err)
+			return err
+		}
+	}
+
+	return utils.DB().DeleteObj(userID, Сollection)
+}
+
+// Отложенное удаление аккаунта
+//
+// Помечает аккаунт на удаление через grace и завершает все сессии пользователя.
+// До окончательного удаления аккаунт можно восстановить через CancelAccountDeletion,
+// окончательное удаление выполняет PurgeDeletedAccounts
+func ScheduleAccountDeletion(userID primitive.ObjectID, grace time.Duration) error {
+	now := time.Now()
+
+	err := utils.DB().UpdateObj(userID, Сollection, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "secure.deletion", Value: secure.Deletion{Requested: now, Purge: now.Add(grace)}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = secure.RemoveAllSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	return secure.RevokeTokens(userID)
+}
+
+// Отмена отложенного удаления аккаунта
+func CancelAccountDeletion(userID primitive.ObjectID) error {
+	var modified int64
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res, err := w.Collection(Сollection).UpdateOne(
+			ctx,
+			bson.D{
+				{Key: "_id", Value: userID},
+				{Key: "secure.deletion", Value: bson.D{{Key: "$exists", Value: true}}},
+			},
+			bson.D{{Key: "$unset", Value: bson.D{{Key: "secure.deletion", Value: ""}}}},
+		)
+		if err != nil {
+			return err
+		}
+
+		modified = res.ModifiedCount
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if modified == 0 {
+		return ErrDeletionNotPending
+	}
+
+	return nil
+}
+
+// Окончательное удаление аккаунтов, срок восстановления которых истек
+//
+// Возвращает колличество удаленных аккаунтов
+func PurgeDeletedAccounts() (int, error) {
+	ids, err := findAccountIDs(bson.D{
+		{Key: "secure.deletion.purge", Value: bson.D{{Key: "$lte", Value: time.Now()}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleteAccounts(ids)
+}
+
+// Запуск фонового удаления аккаунтов
+//
+// Каждые interval окончательно удаляет аккаунты, срок восстановления которых истек.
+// Возвращает функцию для остановки процесса
+func StartDeletionPurge(interval time.Duration) func() {
+	stop := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, err := PurgeDeletedAccounts()
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
+
+func deleteAccounts(ids []primitive.ObjectID) (int, error) {
+	deleted := 0
+	for _, id := range ids {
+		err := DeleteAccount(id)
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// Получение идентификаторов аккаунтов по фильтру
+func findAccountIDs(filter bson.D) ([]primitive.ObjectID, error) {
+	items := []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}{}
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		cur, err := w.Collection(Сollection).Find(
+			ctx,
+			filter,
+			options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}),
+		)
+		if err != nil {
+			return err
+		}
+
+		return cur.All(ctx, &items)
+	})
+
+	ids := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	return ids, err
+}
+
+// Удаление персональных правил доступа пользователя
+func removeUserPrivileges(userID primitive.ObjectID) error {
+	return utils.Privileges().RemoveUser(userID)
+}
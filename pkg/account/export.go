@@ -0,0 +1,186 @@
+package account
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	exporters = []namedExporter{
+		{name: "profile", exporter: exportProfile},
+		{name: "auth", exporter: exportAuth},
+		{name: "sessions", exporter: exportSessions},
+	}
+
+	// Поля данных авторизации, которые не выгружаются пользователю
+	secretAuthFields = map[string]bool{
+		"hash":       true,
+		"change_key": true,
+		"revert_key": true,
+	}
+)
+
+// Функция выгрузки данных пользователя из модуля
+//
+// Возвращаемое значение будет сохранено в архив в формате JSON
+type Exporter func(userID primitive.ObjectID) (interface{}, error)
+
+type namedExporter struct {
+	name     string
+	exporter Exporter
+}
+
+// Регистрация выгрузки данных модуля
+//
+// Модули, хранящие данные пользователя в собственных коллекциях, должны зарегистрировать
+// выгрузку при инициализации, данные будут сохранены в архив в файл name.json.
+// Повторная регистрация с тем же именем заменяет предыдущую
+func RegisterExporter(name string, exporter Exporter) {
+	for i, item := range exporters {
+		if item.name == name {
+			exporters[i].exporter = exporter
+			return
+		}
+	}
+
+	exporters = append(exporters, namedExporter{name: name, exporter: exporter})
+}
+
+// Выгрузка данных пользователя
+//
+// Записывает в w zip архив с JSON файлами: профиль, метаданные способов авторизации (без хешей и ключей),
+// сессии (без ключей) и данные всех зарегистрированных модулей.
+// Используется для ответа на запросы субъектов персональных данных (GDPR).
+// Данные всех модулей загружаются до начала записи, поэтому при ошибке выгрузки в w ничего не записывается
+func Export(userID primitive.ObjectID, w io.Writer) error {
+	data := make([]interface{}, len(exporters))
+	for i, item := range exporters {
+		value, err := item.exporter(userID)
+		if err != nil {
+			return err
+		}
+
+		data[i] = value
+	}
+
+	archive := zip.NewWriter(w)
+
+	for i, item := range exporters {
+		err := writeExport(archive, item.name, data[i])
+		if err != nil {
+			archive.Close()
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeExport(archive *zip.Writer, name string, data interface{}) error {
+	file, err := archive.Create(name + ".json")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+func loadAccount(userID primitive.ObjectID) (*Account, error) {
+	acc := &Account{}
+	err := utils.DB().GetObj(userID, acc)
+	return acc, err
+}
+
+func exportProfile(userID primitive.ObjectID) (interface{}, error) {
+	acc, err := loadAccount(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := struct {
+		ID    primitive.ObjectID `json:"id"`
+		Name  string             `json:"name"`
+		Group string             `json:"group"`
+		Guest bool               `json:"guest"`
+		Ban   interface{}        `json:"ban,omitempty"`
+	}{
+		ID:    acc.ID,
+		Name:  acc.Name,
+		Group: acc.Secure.Access,
+		Guest: acc.Secure.Guest,
+	}
+
+	if acc.Secure.Ban != nil {
+		profile.Ban = struct {
+			Reason string     `json:"reason"`
+			Since  time.Time  `json:"since"`
+			Until  *time.Time `json:"until,omitempty"`
+		}{acc.Secure.Ban.Reason, acc.Secure.Ban.Since, acc.Secure.Ban.Until}
+	}
+
+	return profile, nil
+}
+
+func exportAuth(userID primitive.ObjectID) (interface{}, error) {
+	acc, err := loadAccount(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	methods := map[string]map[string]interface{}{}
+	for provider, data := range acc.Secure.AuthData {
+		fields := exportDocument(data)
+
+		methods[provider] = map[string]interface{}{}
+		for key, value := range fields {
+			if secretAuthFields[key] {
+				continue
+			}
+
+			if _, binary := value.(primitive.Binary); binary {
+				continue
+			}
+
+			methods[provider][key] = value
+		}
+	}
+
+	return methods, nil
+}
+
+func exportSessions(userID primitive.ObjectID) (interface{}, error) {
+	acc, err := loadAccount(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []string{}
+	for _, session := range acc.Secure.Sessions {
+		sessions = append(sessions, session.Name)
+	}
+
+	return struct {
+		Sessions []string `json:"sessions"`
+	}{sessions}, nil
+}
+
+// Приведение вложенного BSON документа к map
+func exportDocument(data interface{}) map[string]interface{} {
+	switch document := data.(type) {
+	case map[string]interface{}:
+		return document
+	case primitive.M:
+		return document
+	case primitive.D:
+		return document.Map()
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,118 @@
+package account
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrUnknownGroup = errors.New("группа не зарегистрирована в хранилище привилегий")
+	ErrBannedGroup  = errors.New("для перевода пользователя в группу banned следует использовать Ban")
+)
+
+// Получение группы пользователя
+func GetGroup(userID primitive.ObjectID) (string, error) {
+	acc := Account{}
+	err := utils.DB().GetObj(userID, &acc)
+	if err != nil {
+		return "", err
+	}
+
+	return acc.Secure.Access, nil
+}
+
+// Установка группы пользователя
+//
+// Группа должна быть известна хранилищу привилегий utils.Privileges().
+// Токены пользователя отзываются, поэтому сессии получат новую группу при следующем обновлении токена.
+// Если пользователь заблокирован, группа будет установлена после снятия блокировки
+func SetGroup(userID primitive.ObjectID, group string) error {
+	if group == secure.BannedGroup {
+		return ErrBannedGroup
+	}
+
+	if !utils.Privileges().HasGroup(group) {
+		return ErrUnknownGroup
+	}
+
+	var matched int64
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res, err := w.Collection(Сollection).UpdateOne(ctx, bson.D{{Key: "_id", Value: userID}}, bson.A{
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "secure", Value: bson.D{{Key: "$cond", Value: bson.A{
+					bson.D{{Key: "$eq", Value: bson.A{"$secure.access", secure.BannedGroup}}},
+					bson.D{{Key: "$mergeObjects", Value: bson.A{
+						"$secure",
+						bson.D{{Key: "ban", Value: bson.D{{Key: "$mergeObjects", Value: bson.A{
+							"$secure.ban",
+							bson.D{{Key: "group", Value: group}},
+						}}}}},
+					}}},
+					bson.D{{Key: "$mergeObjects", Value: bson.A{
+						"$secure",
+						bson.D{{Key: "access", Value: group}},
+					}}},
+				}}}},
+			}}},
+		})
+		if err != nil {
+			return err
+		}
+
+		matched = res.MatchedCount
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if matched == 0 {
+		return ErrAccountNotFound
+	}
+
+	return secure.RevokeTokens(userID)
+}
+
+// Перенос групп пользователей в поле secure.access
+//
+// Ранее CreateNewAccount сохранял группу в поле group верхнего уровня,
+// тогда как проверка сессий читает secure.access. Функция переносит значение
+// для документов, в которых secure.access не установлен, и удаляет устаревшее поле.
+// Возвращает колличество обновленных документов
+func MigrateGroups() (int64, error) {
+	var modified int64
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res, err := w.Collection(Сollection).UpdateMany(
+			ctx,
+			bson.D{{Key: "group", Value: bson.D{{Key: "$exists", Value: true}}}},
+			bson.A{
+				bson.D{{Key: "$set", Value: bson.D{
+					{Key: "secure.access", Value: bson.D{{Key: "$cond", Value: bson.A{
+						bson.D{{Key: "$eq", Value: bson.A{
+							bson.D{{Key: "$ifNull", Value: bson.A{"$secure.access", ""}}},
+							"",
+						}}},
+						"$group",
+						"$secure.access",
+					}}}},
+				}}},
+				bson.D{{Key: "$unset", Value: "group"}},
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		modified = res.ModifiedCount
+		return nil
+	})
+
+	return modified, err
+}
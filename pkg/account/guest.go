@@ -0,0 +1,169 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotGuest = errors.New("аккаунт не является гостевым")
+)
+
+// Создание постоянного гостевого аккаунта
+//
+// Гостевой аккаунт является полноценным документом в коллекции Account,
+// поэтому может владеть корзинами, чатами и уведомлениями
+func CreateGuestAccount(session secure.Session) (primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+	defer cancel()
+
+	s := secure.Secure{
+		Access:   secure.GuestGroup,
+		Sessions: []secure.Session{session},
+		Guest:    true,
+		Seen:     time.Now(),
+	}
+
+	res, err := utils.DB().Collection(Сollection).InsertOne(ctx, bson.D{
+		{Key: "name", Value: ""},
+		{Key: "secure", Value: s},
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return res.InsertedID.(primitive.ObjectID), nil
+}
+
+// Получение гостевого аккаунта для текущего запроса
+//
+// Функция предназначена для запросов, прошедших через secure.SiteAuthMiddleware.
+// Если посетитель уже авторизован (в том числе как гость), возвращает запрос без изменений,
+// иначе создает гостевой аккаунт, записывает токен в cookie и возвращает запрос с обновленным контекстом.
+// Аккаунт создается лениво, только когда гостю требуется владеть данными
+func EnsureGuest(w http.ResponseWriter, r *http.Request, sessionName string) (*http.Request, primitive.ObjectID, error) {
+	userID := secure.UserIDFromContext(r.Context())
+	if !userID.IsZero() {
+		return r, userID, nil
+	}
+
+	session := secure.CreateSession(sessionName)
+	userID, err := CreateGuestAccount(session)
+	if err != nil {
+		return r, primitive.NilObjectID, err
+	}
+
+	token, err := secure.CreateNewUserToken(userID, secure.GuestGroup, session.Key)
+	if err != nil {
+		return r, primitive.NilObjectID, err
+	}
+
+	secure.WriteTokenCookie(w, token)
+	ctx := secure.ContextWithUser(r.Context(), userID, secure.GuestGroup, session.Key)
+	return r.WithContext(ctx), userID, nil
+}
+
+// Перевод гостевого аккаунта в зарегистрированный
+//
+// Аккаунт обновляется на месте, поэтому сохраняет свой ObjectID и все связанные с ним данные.
+// Вызывается провайдером авторизации после сохранения данных для входа
+func UpgradeGuestAccount(userID primitive.ObjectID, name string, group string) error {
+	var matched int64
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res, err := w.Collection(Сollection).UpdateOne(
+			ctx,
+			bson.D{
+				{Key: "_id", Value: userID},
+				{Key: "secure.guest", Value: true},
+			},
+			bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "name", Value: name},
+					{Key: "secure.access", Value: group},
+				}},
+				{Key: "$unset", Value: bson.D{
+					{Key: "secure.guest", Value: ""},
+					{Key: "secure.seen", Value: ""},
+				}},
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		matched = res.MatchedCount
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if matched == 0 {
+		return ErrNotGuest
+	}
+
+	return nil
+}
+
+// Проверка, является ли аккаунт гостевым
+func IsGuestAccount(userID primitive.ObjectID) (bool, error) {
+	count, err := utils.DB().CountElements(Сollection, bson.D{
+		{Key: "_id", Value: userID},
+		{Key: "secure.guest", Value: true},
+	})
+
+	return count != 0, err
+}
+
+// Удаление неактивных гостевых аккаунтов
+//
+// Удаляет гостевые аккаунты, последняя активность которых была раньше чем ttl назад,
+// данные гостей в модулях очищаются так же, как при удалении через DeleteAccount
+func RemoveStaleGuests(ttl time.Duration) (int, error) {
+	ids, err := findAccountIDs(bson.D{
+		{Key: "secure.guest", Value: true},
+		{Key: "secure.seen", Value: bson.D{{Key: "$lt", Value: time.Now().Add(-ttl)}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleteAccounts(ids)
+}
+
+// Запуск фоновой очистки гостевых аккаунтов
+//
+// Каждые interval удаляет гостевые аккаунты, неактивные дольше ttl.
+// Возвращает функцию для остановки очистки
+func StartGuestCleanup(interval time.Duration, ttl time.Duration) func() {
+	stop := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, err := RemoveStaleGuests(ttl)
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
@@ -26,11 +26,10 @@ func CreateNewAccount(name string, group string, session secure.Session) (primit
 	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
 	defer cancel()
 
-	s := secure.Secure{Sessions: []secure.Session{session}}
+	s := secure.Secure{Access: group, Sessions: []secure.Session{session}}
 
 	res, err := utils.DB().Collection(Сollection).InsertOne(ctx, bson.D{
 		{Key: "name", Value: name},
-		{Key: "group", Value: group},
 		{Key: "secure", Value: s},
 	})
 	if err != nil {
@@ -39,8 +38,3 @@ func CreateNewAccount(name string, group string, session secure.Session) (primit
 
 	return res.InsertedID.(primitive.ObjectID), nil
 }
-
-// Удаление аккаунта пользователя из системы
-func DeleteAccount(userID primitive.ObjectID) error {
-	return utils.DB().DeleteObj(userID, Сollection)
-}
@@ -0,0 +1,45 @@
+package notification
+
+import (
+	"context"
+
+	"github.com/ReanSn0w/gobase/pkg/account"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func init() {
+	account.RegisterExporter("notifications", exportNotifications)
+	account.RegisterDeletionHook("notifications", anonymizeNotifications)
+}
+
+// Выгрузка всех уведомлений пользователя
+func exportNotifications(userID primitive.ObjectID) (interface{}, error) {
+	return find(bson.D{{Key: "recipient", Value: userID}}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+}
+
+// Удаление уведомлений пользователя и обезличивание вызванных им уведомлений
+//
+// Уведомления, адресованные пользователю, удаляются,
+// в уведомлениях других пользователей поле from заменяется на NilObjectID
+func anonymizeNotifications(userID primitive.ObjectID) error {
+	return utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		c := w.Collection(collection)
+
+		_, err := c.DeleteMany(ctx, bson.D{{Key: "recipient", Value: userID}})
+		if err != nil {
+			return err
+		}
+
+		_, err = c.UpdateMany(
+			ctx,
+			bson.D{{Key: "from", Value: userID}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "from", Value: primitive.NilObjectID}}}},
+		)
+
+		return err
+	})
+}
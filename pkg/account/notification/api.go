@@ -0,0 +1,173 @@
+package notification
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// Размер страницы уведомлений по умолчанию
+	DefaultPageLimit = 20
+	// Максимальный размер страницы уведомлений
+	MaxPageLimit = 100
+
+	ErrUnvalidLimit = errors.New("некорректный размер страницы")
+)
+
+// Монтирование API уведомлений
+//
+// Все методы работают с уведомлениями текущего пользователя и требуют авторизации через APIAuthMiddleware,
+// потоки уведомлений - через StreamAuthMiddleware и WebSocketAuthMiddleware,
+// так как браузер не передает заголовки при их открытии:
+//
+//	GET    /                - страница уведомлений (?before=<id>&limit=<n>)
+//	GET    /unread          - колличество непрочитанных уведомлений
+//	POST   /read            - прочтение всех уведомлений или созданных не позднее ?until=<RFC3339>
+//	POST   /{id}/read       - прочтение уведомления
+//	DELETE /                - удаление всех уведомлений
+//	DELETE /{id}            - удаление уведомления
+//	GET    /stream          - поток новых уведомлений через Server-Sent Events (см. StreamHandler)
+//	GET    /ws              - поток новых уведомлений через WebSocket (см. WebSocketHandler)
+func Mount(r chi.Router) {
+	r.With(secure.StreamAuthMiddleware).Get("/stream", StreamHandler)
+	r.With(secure.WebSocketAuthMiddleware).Get("/ws", WebSocketHandler)
+
+	r.Group(func(r chi.Router) {
+		r.Use(secure.APIAuthMiddleware)
+
+		r.Get("/", listHandler)
+		r.Get("/unread", unreadHandler)
+		r.Post("/read", readAllHandler)
+		r.Post("/{id}/read", readHandler)
+		r.Delete("/", deleteAllHandler)
+		r.Delete("/{id}", deleteHandler)
+	})
+}
+
+func listHandler(w http.ResponseWriter, r *http.Request) {
+	before := primitive.NilObjectID
+	if value := r.URL.Query().Get("before"); value != "" {
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			utils.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		before = id
+	}
+
+	limit := DefaultPageLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number <= 0 || number > MaxPageLimit {
+			utils.ResponseError(w, http.StatusBadRequest, ErrUnvalidLimit)
+			return
+		}
+
+		limit = number
+	}
+
+	notifications, err := List(secure.UserIDFromContext(r.Context()), before, limit)
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.Response(w, http.StatusOK, notifications)
+}
+
+func unreadHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := UnreadCount(secure.UserIDFromContext(r.Context()))
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.Response(w, http.StatusOK, map[string]int64{"unread": count})
+}
+
+func readAllHandler(w http.ResponseWriter, r *http.Request) {
+	profileID := secure.UserIDFromContext(r.Context())
+
+	var (
+		updated int64
+		err     error
+	)
+
+	if value := r.URL.Query().Get("until"); value != "" {
+		until, parseErr := time.Parse(time.RFC3339, value)
+		if parseErr != nil {
+			utils.ResponseError(w, http.StatusBadRequest, parseErr)
+			return
+		}
+
+		updated, err = MarkReadBefore(profileID, until)
+	} else {
+		updated, err = MarkAllRead(profileID)
+	}
+
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.Response(w, http.StatusOK, map[string]int64{"updated": updated})
+}
+
+func readHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = MarkRead(secure.UserIDFromContext(r.Context()), id)
+	if err != nil {
+		responseNotificationError(w, err)
+		return
+	}
+
+	utils.Response(w, http.StatusNoContent, nil)
+}
+
+func deleteAllHandler(w http.ResponseWriter, r *http.Request) {
+	deleted, err := DeleteAll(secure.UserIDFromContext(r.Context()))
+	if err != nil {
+		utils.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.Response(w, http.StatusOK, map[string]int64{"deleted": deleted})
+}
+
+func deleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = Delete(secure.UserIDFromContext(r.Context()), id)
+	if err != nil {
+		responseNotificationError(w, err)
+		return
+	}
+
+	utils.Response(w, http.StatusNoContent, nil)
+}
+
+func responseNotificationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotificationNotFound) {
+		utils.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+
+	utils.ResponseError(w, http.StatusInternalServerError, err)
+}
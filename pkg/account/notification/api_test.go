@@ -0,0 +1,48 @@
+package notification_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/notification"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_MountRejectsUnvalidParams(t *testing.T) {
+	token, err := utils.JWT().GenerateToken(jwt.MapClaims{
+		"user_id":    primitive.NewObjectID().Hex(),
+		"user_group": "user",
+		"session":    "session",
+		"issued":     time.Now().UnixMilli(),
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	notification.Mount(r)
+
+	requests := []struct{ method, path string }{
+		{http.MethodPost, "/read?until=yesterday"},
+		{http.MethodPost, "/not-an-id/read"},
+		{http.MethodDelete, "/not-an-id"},
+	}
+
+	for _, item := range requests {
+		req := httptest.NewRequest(item.method, item.path, nil)
+		req.Header.Set("Authorization", token)
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: код %d вместо 400", item.method, item.path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package notification
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Доступ к внутренним функциям пакета для тестов
+var (
+	LegacyNotificationID = legacyNotificationID
+	OnlyDuplicates       = onlyDuplicates
+)
+
+// Подмена загрузки получателей и записи уведомлений при доставке без обращения к базе данных,
+// возвращает функцию восстановления
+func SetDeliveryStorage(
+	load func([]primitive.ObjectID) (map[primitive.ObjectID]bool, error),
+	write func([]interface{}) ([]mongo.BulkWriteError, error),
+) func() {
+	previousLoad, previousWrite := recipientsLoader, notificationsWriter
+	recipientsLoader, notificationsWriter = load, write
+
+	return func() { recipientsLoader, notificationsWriter = previousLoad, previousWrite }
+}
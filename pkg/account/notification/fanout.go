@@ -0,0 +1,263 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Результат доставки уведомления получателю
+const (
+	StatusDelivered = "delivered" // уведомление записано
+	StatusSender    = "sender"    // получатель является отправителем
+	StatusInactive  = "inactive"  // аккаунт получателя ожидает удаления
+	StatusNotFound  = "not_found" // аккаунт получателя не найден
+	StatusDuplicate = "duplicate" // получатель указан повторно
+	StatusFailed    = "failed"    // ошибка записи
+)
+
+var (
+	ErrDeliveryFailed = errors.New("уведомление не доставлено части получателей")
+
+	// Параметры отправки для Send
+	DefaultSendOptions = SendOptions{SkipInactive: true, ChunkSize: 500}
+
+	// Загрузка аккаунтов получателей и запись уведомлений при доставке
+	recipientsLoader    = loadRecipients
+	notificationsWriter = writeNotifications
+)
+
+// Параметры отправки уведомления
+type SendOptions struct {
+	SkipSender   bool // не отправлять уведомление пользователю From
+	SkipInactive bool // не отправлять уведомление аккаунтам, ожидающим удаления
+	ChunkSize    int  // колличество получателей, обрабатываемых одним запросом
+}
+
+// Результат доставки уведомления одному получателю
+type RecipientResult struct {
+	Recipient    primitive.ObjectID `json:"recipient"`
+	Status       string             `json:"status"`
+	Notification primitive.ObjectID `json:"notification,omitempty"` // идентификатор записанного уведомления
+	Error        string             `json:"error,omitempty"`
+}
+
+// Отчет о доставке уведомления
+type DeliveryReport struct {
+	Results []RecipientResult `json:"results"` // результаты в порядке получателей
+}
+
+// Колличество получателей с указанным статусом
+func (r *DeliveryReport) Count(status string) int {
+	count := 0
+	for _, item := range r.Results {
+		if item.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Ошибка доставки, если хотя бы одному получателю не удалось записать уведомление
+func (r *DeliveryReport) Err() error {
+	if failed := r.Count(StatusFailed); failed != 0 {
+		return fmt.Errorf("%w: %d из %d", ErrDeliveryFailed, failed, len(r.Results))
+	}
+
+	return nil
+}
+
+// Отправка уведомления пользователям с отчетом о доставке
+//
+// Получатели обрабатываются частями по opts.ChunkSize: для каждой части одним запросом проверяются
+// аккаунты получателей и одной пакетной операцией записываются уведомления.
+// Записанные уведомления публикуются в хаб для доставки подключенным получателям (см. DefaultHub).
+// Ошибка возвращается только если доставку не удалось выполнить, ошибки записи отдельным получателям
+// отражаются в отчете со статусом StatusFailed
+func (n *Notification) Deliver(opts SendOptions, profiles ...primitive.ObjectID) (*DeliveryReport, error) {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultSendOptions.ChunkSize
+	}
+
+	report := &DeliveryReport{Results: make([]RecipientResult, len(profiles))}
+	pending := make([]int, 0, len(profiles))
+	known := map[primitive.ObjectID]bool{}
+
+	for i, profileID := range profiles {
+		report.Results[i].Recipient = profileID
+
+		switch {
+		case known[profileID]:
+			report.Results[i].Status = StatusDuplicate
+		case opts.SkipSender && profileID == n.From:
+			report.Results[i].Status = StatusSender
+		default:
+			pending = append(pending, i)
+		}
+
+		known[profileID] = true
+	}
+
+	for start := 0; start < len(pending); start += opts.ChunkSize {
+		end := start + opts.ChunkSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+
+		err := n.deliverChunk(report, pending[start:end], opts)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// Доставка уведомления части получателей
+//
+// chunk содержит позиции получателей в отчете
+func (n *Notification) deliverChunk(report *DeliveryReport, chunk []int, opts SendOptions) error {
+	ids := make([]primitive.ObjectID, 0, len(chunk))
+	for _, i := range chunk {
+		ids = append(ids, report.Results[i].Recipient)
+	}
+
+	accounts, err := recipientsLoader(ids)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	var expires *time.Time
+	if n.TTL > 0 {
+		value := now.Add(n.TTL)
+		expires = &value
+	}
+
+	documents := []interface{}{}
+	positions := []int{}
+
+	for _, i := range chunk {
+		result := &report.Results[i]
+
+		inactive, exists := accounts[result.Recipient]
+		switch {
+		case !exists:
+			result.Status = StatusNotFound
+			continue
+		case inactive && opts.SkipInactive:
+			result.Status = StatusInactive
+			continue
+		}
+
+		result.Notification = primitive.NewObjectIDFromTimestamp(now)
+		result.Status = StatusDelivered
+
+		documents = append(documents, Notification{
+			ID:        result.Notification,
+			Recipient: result.Recipient,
+			From:      n.From,
+			Target:    n.Target,
+			Key:       n.Key,
+			Time:      now,
+			Expires:   expires,
+		})
+		positions = append(positions, i)
+	}
+
+	if len(documents) == 0 {
+		return nil
+	}
+
+	failed, err := notificationsWriter(documents)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range failed {
+		result := &report.Results[positions[item.Index]]
+		result.Status = StatusFailed
+		result.Notification = primitive.NilObjectID
+		result.Error = item.Message
+	}
+
+	delivered := make([]Notification, 0, len(documents))
+	for i, document := range documents {
+		if report.Results[positions[i]].Status == StatusDelivered {
+			delivered = append(delivered, document.(Notification))
+		}
+	}
+
+	publish(delivered)
+	return nil
+}
+
+// Запись уведомлений одной пакетной операцией
+//
+// Возвращает ошибки записи отдельных уведомлений, ошибка возвращается только если запись не удалось выполнить
+func writeNotifications(documents []interface{}) ([]mongo.BulkWriteError, error) {
+	var failed []mongo.BulkWriteError
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		_, err := w.Collection(collection).InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+
+		bulk, ok := err.(mongo.BulkWriteException)
+		if !ok {
+			return err
+		}
+
+		if bulk.WriteConcernError != nil {
+			return err
+		}
+
+		failed = bulk.WriteErrors
+		return nil
+	})
+
+	return failed, err
+}
+
+// Получение аккаунтов получателей
+//
+// Возвращает для каждого найденного аккаунта признак ожидания удаления
+func loadRecipients(ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	accounts := []struct {
+		ID     primitive.ObjectID `bson:"_id"`
+		Secure struct {
+			Deletion interface{} `bson:"deletion"`
+		} `bson:"secure"`
+	}{}
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		cur, err := w.Collection(accountCollection).Find(
+			ctx,
+			bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}},
+			options.Find().SetProjection(bson.D{{Key: "secure.deletion", Value: 1}}),
+		)
+		if err != nil {
+			return err
+		}
+
+		return cur.All(ctx, &accounts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[primitive.ObjectID]bool, len(accounts))
+	for _, item := range accounts {
+		result[item.ID] = item.Secure.Deletion != nil
+	}
+
+	return result, nil
+}
@@ -0,0 +1,88 @@
+package notification_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ReanSn0w/gobase/pkg/account/notification"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func Test_DeliverReport(t *testing.T) {
+	sender := primitive.NewObjectID()
+	active, missing, inactive, failing := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	chunks := []int{}
+	restore := notification.SetDeliveryStorage(
+		func(ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+			chunks = append(chunks, len(ids))
+			return map[primitive.ObjectID]bool{active: false, sender: false, inactive: true, failing: false}, nil
+		},
+		func(documents []interface{}) ([]mongo.BulkWriteError, error) {
+			failed := []mongo.BulkWriteError{}
+			for i, document := range documents {
+				if document.(notification.Notification).Recipient == failing {
+					failed = append(failed, mongo.BulkWriteError{WriteError: mongo.WriteError{Index: i, Message: "write failed"}})
+				}
+			}
+
+			return failed, nil
+		},
+	)
+	t.Cleanup(restore)
+
+	n := notification.Notification{From: sender}
+	report, err := n.Deliver(
+		notification.SendOptions{SkipSender: true, SkipInactive: true, ChunkSize: 2},
+		active, active, sender, missing, inactive, failing,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		notification.StatusDelivered,
+		notification.StatusDuplicate,
+		notification.StatusSender,
+		notification.StatusNotFound,
+		notification.StatusInactive,
+		notification.StatusFailed,
+	}
+
+	for i, status := range expected {
+		if report.Results[i].Status != status {
+			t.Errorf("получатель %d: статус %q вместо %q", i, report.Results[i].Status, status)
+		}
+	}
+
+	if report.Results[0].Notification.IsZero() || !report.Results[5].Notification.IsZero() {
+		t.Error("идентификатор уведомления указан неверно")
+	}
+
+	if len(chunks) != 2 || chunks[0] != 2 || chunks[1] != 2 {
+		t.Errorf("получатели обработаны частями %v вместо [2 2]", chunks)
+	}
+
+	if !errors.Is(report.Err(), notification.ErrDeliveryFailed) {
+		t.Errorf("ошибка доставки не возвращена: %v", report.Err())
+	}
+}
+
+func Test_DeliverLoadError(t *testing.T) {
+	loadErr := errors.New("connection refused")
+	restore := notification.SetDeliveryStorage(
+		func([]primitive.ObjectID) (map[primitive.ObjectID]bool, error) { return nil, loadErr },
+		func([]interface{}) ([]mongo.BulkWriteError, error) {
+			t.Error("запись уведомлений после ошибки загрузки получателей")
+			return nil, nil
+		},
+	)
+	t.Cleanup(restore)
+
+	n := notification.Notification{}
+	_, err := n.Deliver(notification.SendOptions{ChunkSize: 1}, primitive.NewObjectID(), primitive.NewObjectID())
+	if !errors.Is(err, loadErr) {
+		t.Errorf("ошибка загрузки получателей не возвращена: %v", err)
+	}
+}
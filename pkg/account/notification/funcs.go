@@ -2,56 +2,239 @@ package notification
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"time"
 
 	"github.com/ReanSn0w/gobase/pkg/utils"
 	"github.com/ReanSn0w/mongo-monkey/wrap"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ErrNotificationNotFound = errors.New("уведомление не найдено")
+)
+
+// Получение страницы уведомлений пользователя
+//
+// Уведомления возвращаются от новых к старым. Для получения следующей страницы
+// в before передается идентификатор последнего полученного уведомления,
+// для первой страницы - primitive.NilObjectID
+func List(profileID primitive.ObjectID, before primitive.ObjectID, limit int) ([]Notification, error) {
+	filter := bson.D{{Key: "recipient", Value: profileID}}
+	if !before.IsZero() {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$lt", Value: before}}})
+	}
+
+	return find(filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetLimit(int64(limit)))
+}
+
+// Получение уведомлений пользователя, созданных после уведомления after
+//
+// Уведомления возвращаются от старых к новым, используется для продолжения потока при переподключении
+func Since(profileID primitive.ObjectID, after primitive.ObjectID, limit int) ([]Notification, error) {
+	return find(bson.D{
+		{Key: "recipient", Value: profileID},
+		{Key: "_id", Value: bson.D{{Key: "$gt", Value: after}}},
+	}, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(limit)))
+}
+
 // Получение списка уведомлений для пользователя
+//
+// Deprecated: смещение требует просмотра всех пропущенных уведомлений, следует использовать List
 func Get(profileID primitive.ObjectID, skip int, limit int) ([]Notification, error) {
-	notifications := []Notification{}
+	return find(bson.D{{Key: "recipient", Value: profileID}}, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit)))
+}
+
+// Установка метки о прочтении уведомления
+func MarkRead(profileID primitive.ObjectID, notificationID primitive.ObjectID) error {
+	var matched int64
 
 	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
-		c := w.Collection(collection)
-
-		cur, err := c.Aggregate(ctx, mongo.Pipeline{
-			{{Key: "$match", Value: bson.D{{Key: "_id", Value: profileID}}}},
-			{{Key: "$unwind", Value: bson.D{
-				{Key: "path", Value: "$notifications"},
-				{Key: "includeArrayIndex", Value: "index"},
-				{Key: "preserveNullAndEmptyArrays", Value: true},
-			}}},
-			{{Key: "$project", Value: bson.D{
-				{Key: "_id", Value: "$index"},
-				{Key: "from", Value: "$notifications.from"},
-				{Key: "target", Value: "$notifications.target"},
-				{Key: "key", Value: "$notifications.key"},
-				{Key: "time", Value: "$notifications.time"},
-				{Key: "read", Value: "$notifications.read"},
-			}}},
-			{{Key: "$sort", Value: bson.D{{Key: "time", Value: -1}}}},
-			{{Key: "$skip", Value: skip}},
-			{{Key: "$limit", Value: limit}},
-		})
+		res, err := w.Collection(collection).UpdateOne(
+			ctx,
+			bson.D{
+				{Key: "_id", Value: notificationID},
+				{Key: "recipient", Value: profileID},
+			},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "read", Value: true}}}},
+		)
 		if err != nil {
 			return err
 		}
 
-		return cur.All(ctx, &notifications)
+		matched = res.MatchedCount
+		return nil
 	})
+	if err != nil {
+		return err
+	}
 
-	return notifications, err
+	if matched == 0 {
+		return ErrNotificationNotFound
+	}
+
+	return nil
 }
 
 // Установка метки о прочтении уведомления
+//
+// Deprecated: element - порядковый номер уведомления от старых к новым, он смещается
+// при удалении уведомлений, следует использовать MarkRead
 func Read(profileID primitive.ObjectID, element int) error {
-	return utils.DB().UpdateObj(profileID, collection, bson.D{
-		{Key: "$set", Value: bson.D{
-			{Key: fmt.Sprintf("notifications.%v.read", element), Value: true},
-		}},
+	notifications, err := find(bson.D{{Key: "recipient", Value: profileID}}, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(int64(element)).
+		SetLimit(1).
+		SetProjection(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+
+	if len(notifications) == 0 {
+		return ErrNotificationNotFound
+	}
+
+	return MarkRead(profileID, notifications[0].ID)
+}
+
+// Колличество непрочитанных уведомлений пользователя
+func UnreadCount(profileID primitive.ObjectID) (int64, error) {
+	var count int64
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) (err error) {
+		count, err = w.Collection(collection).CountDocuments(ctx, unreadFilter(profileID))
+		return err
+	})
+
+	return count, err
+}
+
+// Установка метки о прочтении всех уведомлений пользователя
+//
+// Возвращает колличество отмеченных уведомлений
+func MarkAllRead(profileID primitive.ObjectID) (int64, error) {
+	return markRead(unreadFilter(profileID))
+}
+
+// Установка метки о прочтении уведомлений, созданных не позднее until
+//
+// Возвращает колличество отмеченных уведомлений
+func MarkReadBefore(profileID primitive.ObjectID, until time.Time) (int64, error) {
+	return markRead(append(unreadFilter(profileID), bson.E{Key: "time", Value: bson.D{{Key: "$lte", Value: until}}}))
+}
+
+// Удаление уведомления пользователя
+func Delete(profileID primitive.ObjectID, notificationID primitive.ObjectID) error {
+	deleted, err := deleteMany(bson.D{
+		{Key: "_id", Value: notificationID},
+		{Key: "recipient", Value: profileID},
+	})
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrNotificationNotFound
+	}
+
+	return nil
+}
+
+// Удаление всех уведомлений пользователя
+//
+// Возвращает колличество удаленных уведомлений
+func DeleteAll(profileID primitive.ObjectID) (int64, error) {
+	return deleteMany(bson.D{{Key: "recipient", Value: profileID}})
+}
+
+// Фильтр непрочитанных уведомлений, использует индекс recipient_read_id
+func unreadFilter(profileID primitive.ObjectID) bson.D {
+	return bson.D{
+		{Key: "recipient", Value: profileID},
+		{Key: "read", Value: false},
+	}
+}
+
+func markRead(filter bson.D) (int64, error) {
+	var modified int64
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res, err := w.Collection(collection).UpdateMany(
+			ctx,
+			filter,
+			bson.D{{Key: "$set", Value: bson.D{{Key: "read", Value: true}}}},
+		)
+		if err != nil {
+			return err
+		}
+
+		modified = res.ModifiedCount
+		return nil
+	})
+
+	return modified, err
+}
+
+func deleteMany(filter bson.D) (int64, error) {
+	var deleted int64
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res, err := w.Collection(collection).DeleteMany(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		deleted = res.DeletedCount
+		return nil
 	})
+
+	return deleted, err
+}
+
+func find(filter bson.D, opts *options.FindOptions) ([]Notification, error) {
+	notifications := []Notification{}
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		cur, err := w.Collection(collection).Find(ctx, filter, opts)
+		if err != nil {
+			return err
+		}
+
+		return cur.All(ctx, &notifications)
+	})
+
+	return notifications, err
+}
+
+// Индексы коллекции уведомлений
+func indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "recipient", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("recipient_id"),
+		},
+		{
+			Keys:    bson.D{{Key: "recipient", Value: 1}, {Key: "read", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("recipient_read_id"),
+		},
+		{
+			Keys:    bson.D{{Key: "from", Value: 1}},
+			Options: options.Index().SetName("from"),
+		},
+		{
+			// уведомления без поля expires не удаляются
+			Keys:    bson.D{{Key: "expires", Value: 1}},
+			Options: options.Index().SetName("expires_ttl").SetExpireAfterSeconds(0),
+		},
+	}
 }
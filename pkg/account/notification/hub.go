@@ -0,0 +1,184 @@
+package notification
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrSubscriptionOverflow = errors.New("получатель не успевает обрабатывать уведомления")
+
+	// Размер очереди уведомлений одного подключения
+	SubscriptionBuffer = 64
+
+	hub = NewHub()
+)
+
+// Брокер для доставки уведомлений между экземплярами приложения
+//
+// Publish должен передать уведомление обработчикам Subscribe всех экземпляров, включая текущий
+type Broker interface {
+	Publish(n Notification) error
+	Subscribe(handler func(Notification)) (unsubscribe func(), err error)
+}
+
+// Хаб доставки уведомлений подключенным пользователям
+type Hub struct {
+	mutex       sync.RWMutex
+	subscribers map[primitive.ObjectID]map[*Subscription]struct{}
+	broker      Broker
+	unsubscribe func()
+}
+
+// Подписка пользователя на новые уведомления
+//
+// Канал C закрывается при вызове Close или при переполнении очереди,
+// в последнем случае Err вернет ErrSubscriptionOverflow
+type Subscription struct {
+	C <-chan Notification
+
+	hub       *Hub
+	recipient primitive.ObjectID
+	channel   chan Notification
+	once      sync.Once
+	err       error
+}
+
+// Хаб, используемый при отправке уведомлений и в обработчиках SSE и WebSocket
+func DefaultHub() *Hub {
+	return hub
+}
+
+// Создание хаба, доставляющего уведомления в пределах приложения
+func NewHub() *Hub {
+	return &Hub{subscribers: map[primitive.ObjectID]map[*Subscription]struct{}{}}
+}
+
+// Установка брокера для доставки уведомлений между экземплярами приложения
+//
+// nil возвращает хаб к доставке в пределах приложения
+func (h *Hub) SetBroker(broker Broker) error {
+	var unsubscribe func()
+
+	if broker != nil {
+		var err error
+		unsubscribe, err = broker.Subscribe(h.deliver)
+		if err != nil {
+			return err
+		}
+	}
+
+	h.mutex.Lock()
+	previous := h.unsubscribe
+	h.broker, h.unsubscribe = broker, unsubscribe
+	h.mutex.Unlock()
+
+	if previous != nil {
+		previous()
+	}
+
+	return nil
+}
+
+// Публикация уведомления
+//
+// При установленном брокере уведомление доставляется через него, иначе - подписчикам хаба
+func (h *Hub) Publish(n Notification) error {
+	h.mutex.RLock()
+	broker := h.broker
+	h.mutex.RUnlock()
+
+	if broker != nil {
+		return broker.Publish(n)
+	}
+
+	h.deliver(n)
+	return nil
+}
+
+// Подписка на уведомления пользователя
+func (h *Hub) Subscribe(profileID primitive.ObjectID) *Subscription {
+	channel := make(chan Notification, SubscriptionBuffer)
+	subscription := &Subscription{C: channel, hub: h, recipient: profileID, channel: channel}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.subscribers[profileID] == nil {
+		h.subscribers[profileID] = map[*Subscription]struct{}{}
+	}
+
+	h.subscribers[profileID][subscription] = struct{}{}
+	return subscription
+}
+
+// Колличество подключений пользователя
+func (h *Hub) Connections(profileID primitive.ObjectID) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return len(h.subscribers[profileID])
+}
+
+// Доставка уведомления подписчикам получателя
+//
+// Подписка, очередь которой заполнена, закрывается, чтобы клиент переподключился
+// и получил пропущенные уведомления из базы данных
+func (h *Hub) deliver(n Notification) {
+	overflowed := []*Subscription{}
+
+	h.mutex.RLock()
+	for subscription := range h.subscribers[n.Recipient] {
+		select {
+		case subscription.channel <- n:
+		default:
+			overflowed = append(overflowed, subscription)
+		}
+	}
+	h.mutex.RUnlock()
+
+	for _, subscription := range overflowed {
+		subscription.close(ErrSubscriptionOverflow)
+	}
+}
+
+// Отмена подписки
+func (s *Subscription) Close() {
+	s.close(nil)
+}
+
+// Причина закрытия подписки
+func (s *Subscription) Err() error {
+	s.hub.mutex.RLock()
+	defer s.hub.mutex.RUnlock()
+
+	return s.err
+}
+
+func (s *Subscription) close(err error) {
+	s.once.Do(func() {
+		s.hub.mutex.Lock()
+		defer s.hub.mutex.Unlock()
+
+		s.err = err
+		delete(s.hub.subscribers[s.recipient], s)
+		if len(s.hub.subscribers[s.recipient]) == 0 {
+			delete(s.hub.subscribers, s.recipient)
+		}
+
+		close(s.channel)
+	})
+}
+
+// Публикация записанных уведомлений
+func publish(notifications []Notification) {
+	for _, item := range notifications {
+		err := hub.Publish(item)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
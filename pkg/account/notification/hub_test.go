@@ -0,0 +1,139 @@
+package notification_test
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/notification"
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testBroker struct {
+	handlers []func(notification.Notification)
+}
+
+func (b *testBroker) Publish(n notification.Notification) error {
+	for _, handler := range b.handlers {
+		handler(n)
+	}
+
+	return nil
+}
+
+func (b *testBroker) Subscribe(handler func(notification.Notification)) (func(), error) {
+	b.handlers = append(b.handlers, handler)
+	return func() { b.handlers = nil }, nil
+}
+
+func Test_HubDeliversToRecipient(t *testing.T) {
+	hub := notification.NewHub()
+	recipient, other := primitive.NewObjectID(), primitive.NewObjectID()
+
+	subscription := hub.Subscribe(recipient)
+	defer subscription.Close()
+
+	hub.Publish(notification.Notification{ID: primitive.NewObjectID(), Recipient: other})
+	hub.Publish(notification.Notification{ID: primitive.NewObjectID(), Recipient: recipient, Key: "test"})
+
+	item := <-subscription.C
+	if item.Recipient != recipient || item.Key != "test" {
+		t.Errorf("получено уведомление другого пользователя: %+v", item)
+	}
+
+	subscription.Close()
+	if _, ok := <-subscription.C; ok {
+		t.Error("канал подписки не закрыт")
+	}
+
+	if hub.Connections(recipient) != 0 {
+		t.Error("подписка не удалена из хаба")
+	}
+}
+
+func Test_HubOverflowClosesSubscription(t *testing.T) {
+	hub := notification.NewHub()
+	recipient := primitive.NewObjectID()
+	subscription := hub.Subscribe(recipient)
+
+	for i := 0; i <= notification.SubscriptionBuffer; i++ {
+		hub.Publish(notification.Notification{ID: primitive.NewObjectID(), Recipient: recipient})
+	}
+
+	received := 0
+	for range subscription.C {
+		received++
+	}
+
+	if received != notification.SubscriptionBuffer {
+		t.Errorf("ожидалось %d уведомлений, получено %d", notification.SubscriptionBuffer, received)
+	}
+
+	if !errors.Is(subscription.Err(), notification.ErrSubscriptionOverflow) {
+		t.Errorf("неожиданная причина закрытия подписки: %v", subscription.Err())
+	}
+}
+
+func Test_HubBroker(t *testing.T) {
+	broker := &testBroker{}
+	first, second := notification.NewHub(), notification.NewHub()
+	recipient := primitive.NewObjectID()
+
+	for _, hub := range []*notification.Hub{first, second} {
+		err := hub.SetBroker(broker)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subscription := second.Subscribe(recipient)
+	defer subscription.Close()
+
+	err := first.Publish(notification.Notification{ID: primitive.NewObjectID(), Recipient: recipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-subscription.C:
+	default:
+		t.Error("уведомление не доставлено через брокер")
+	}
+}
+
+func Test_StreamHandler(t *testing.T) {
+	recipient := primitive.NewObjectID()
+	id := primitive.NewObjectID()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := secure.ContextWithUser(r.Context(), recipient, "user", "")
+		notification.StreamHandler(w, r.WithContext(ctx))
+	}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	for notification.DefaultHub().Connections(recipient) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	notification.DefaultHub().Publish(notification.Notification{ID: id, Recipient: recipient})
+
+	reader := bufio.NewReader(res.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "id: "+id.Hex()+"\n" {
+		t.Errorf("неожиданное начало события: %q", line)
+	}
+}
@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Создание индексов и перенос уведомлений из профилей пользователей
+//
+// Уведомления, хранившиеся в массиве notifications документа Account, переносятся в коллекцию Notification,
+// после чего массив удаляется из профиля. Идентификаторы перенесенных уведомлений вычисляются
+// из идентификатора профиля и позиции уведомления, поэтому прерванную миграцию можно безопасно повторить.
+// Возвращает колличество перенесенных уведомлений.
+// Функцию следует вызывать при запуске приложения после настройки базы данных
+func Migrate() (int, error) {
+	moved := 0
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		c := w.Collection(collection)
+
+		_, err := c.Indexes().CreateMany(ctx, indexes())
+		if err != nil {
+			return err
+		}
+
+		cur, err := w.Collection(accountCollection).Find(
+			ctx,
+			bson.D{{Key: "notifications", Value: bson.D{{Key: "$exists", Value: true}}}},
+			options.Find().SetProjection(bson.D{{Key: "notifications", Value: 1}}),
+		)
+		if err != nil {
+			return err
+		}
+		defer cur.Close(ctx)
+
+		for cur.Next(ctx) {
+			account := struct {
+				ID            primitive.ObjectID `bson:"_id"`
+				Notifications []Notification     `bson:"notifications"`
+			}{}
+
+			err = cur.Decode(&account)
+			if err != nil {
+				return err
+			}
+
+			documents := make([]interface{}, 0, len(account.Notifications))
+			for i, item := range account.Notifications {
+				item.ID = legacyNotificationID(account.ID, i, item.Time)
+				item.Recipient = account.ID
+				documents = append(documents, item)
+			}
+
+			if len(documents) != 0 {
+				_, err = c.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+				if err != nil && !onlyDuplicates(err) {
+					return err
+				}
+			}
+
+			_, err = w.Collection(accountCollection).UpdateByID(ctx, account.ID, bson.D{
+				{Key: "$unset", Value: bson.D{{Key: "notifications", Value: ""}}},
+			})
+			if err != nil {
+				return err
+			}
+
+			moved += len(documents)
+		}
+
+		return cur.Err()
+	})
+
+	return moved, err
+}
+
+// Идентификатор уведомления, перенесенного из профиля
+//
+// Содержит время создания уведомления, поэтому сохраняет порядок сортировки
+func legacyNotificationID(accountID primitive.ObjectID, index int, created time.Time) primitive.ObjectID {
+	id := primitive.ObjectID{}
+	binary.BigEndian.PutUint32(id[0:4], uint32(created.Unix()))
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s.%d", accountID.Hex(), index)))
+	copy(id[4:], sum[:8])
+
+	return id
+}
+
+// Проверка, что ошибка вставки вызвана только уже перенесенными уведомлениями
+func onlyDuplicates(err error) bool {
+	bulk, ok := err.(mongo.BulkWriteException)
+	if !ok || bulk.WriteConcernError != nil {
+		return false
+	}
+
+	for _, item := range bulk.WriteErrors {
+		if item.Code != 11000 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,66 @@
+package notification_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/notification"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func Test_LegacyNotificationID(t *testing.T) {
+	account := primitive.NewObjectID()
+	created := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	id := notification.LegacyNotificationID(account, 0, created)
+	if id != notification.LegacyNotificationID(account, 0, created) {
+		t.Error("идентификатор меняется при повторной миграции")
+	}
+
+	if id == notification.LegacyNotificationID(account, 1, created) {
+		t.Error("уведомления с одинаковым временем получили одинаковый идентификатор")
+	}
+
+	if id == notification.LegacyNotificationID(primitive.NewObjectID(), 0, created) {
+		t.Error("уведомления разных пользователей получили одинаковый идентификатор")
+	}
+
+	if !id.Timestamp().Equal(created) {
+		t.Errorf("идентификатор содержит время %v вместо %v", id.Timestamp(), created)
+	}
+
+	// более позднее уведомление с меньшей позицией должно оказаться после более раннего
+	later := notification.LegacyNotificationID(account, 0, created.Add(time.Second))
+	earlier := notification.LegacyNotificationID(account, 5, created)
+	if later.Hex() <= earlier.Hex() {
+		t.Error("идентификаторы не сохраняют порядок по времени создания")
+	}
+}
+
+func Test_OnlyDuplicates(t *testing.T) {
+	writeError := func(code int) mongo.BulkWriteError {
+		return mongo.BulkWriteError{WriteError: mongo.WriteError{Code: code}}
+	}
+
+	cases := []struct {
+		name   string
+		err    error
+		expect bool
+	}{
+		{"duplicates", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{writeError(11000), writeError(11000)}}, true},
+		{"mixed", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{writeError(11000), writeError(2)}}, false},
+		{"write concern", mongo.BulkWriteException{
+			WriteConcernError: &mongo.WriteConcernError{Code: 64},
+			WriteErrors:       []mongo.BulkWriteError{writeError(11000)},
+		}, false},
+		{"other", errors.New("connection refused"), false},
+	}
+
+	for _, item := range cases {
+		if notification.OnlyDuplicates(item.err) != item.expect {
+			t.Errorf("%s: ожидалось %v", item.name, item.expect)
+		}
+	}
+}
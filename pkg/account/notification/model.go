@@ -3,13 +3,17 @@ package notification
 import (
 	"time"
 
-	"github.com/ReanSn0w/gobase/pkg/utils"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
-	collection = "Account" // Данные уведомления хранятця в профиле пользователя
+	collection        = "Notification" // Уведомления хранятся отдельными документами
+	accountCollection = "Account"      // Коллекция профилей, в которых уведомления хранились до миграции
+)
+
+var (
+	// Время жизни уведомлений по умолчанию, нулевое значение - уведомления хранятся бессрочно
+	DefaultTTL time.Duration
 )
 
 // Ключ для уведомления
@@ -24,35 +28,41 @@ func CreateNotification(from primitive.ObjectID, target Target, key Key) *Notifi
 		From:   from,
 		Target: target,
 		Key:    key,
+		TTL:    DefaultTTL,
 	}
 }
 
 // Структура для добавления уведомления
 type Notification struct {
-	Index  int                `json:"index" bson:"index"`   // Поле индекса уведомления, появляется во время агрегации
-	From   primitive.ObjectID `json:"from" bson:"from"`     // идентифицатор пользователя вызвавшего уведомление
-	Target Target             `json:"target" bson:"target"` // ссылка на документ или deeplink
-	Key    Key                `json:"key" bson:"key"`       // ключ уведомления
-	Time   time.Time          `json:"time" bson:"time"`     // время создания уведомления
-	Read   bool               `json:"read" bson:"read"`     // метка прочтения документа
+	ID        primitive.ObjectID `json:"id" bson:"_id"`                              // идентификатор уведомления
+	Recipient primitive.ObjectID `json:"recipient" bson:"recipient"`                 // идентификатор получателя уведомления
+	From      primitive.ObjectID `json:"from" bson:"from"`                           // идентифицатор пользователя вызвавшего уведомление
+	Target    Target             `json:"target" bson:"target"`                       // ссылка на документ или deeplink
+	Key       Key                `json:"key" bson:"key"`                             // ключ уведомления
+	Time      time.Time          `json:"time" bson:"time"`                           // время создания уведомления
+	Read      bool               `json:"read" bson:"read"`                           // метка прочтения документа
+	Expires   *time.Time         `json:"expires,omitempty" bson:"expires,omitempty"` // время удаления уведомления
+
+	TTL time.Duration `json:"-" bson:"-"` // время жизни отправляемого уведомления, нулевое значение - бессрочно
+}
+
+// Установка времени жизни уведомления
+//
+// По истечении ttl уведомление будет удалено из базы данных индексом TTL (см. Migrate)
+func (n *Notification) WithTTL(ttl time.Duration) *Notification {
+	n.TTL = ttl
+	return n
 }
 
 // Метод отправки уведомлений пользователям
+//
+// Отправляет уведомление с параметрами DefaultSendOptions, подробный отчет о доставке возвращает Deliver.
+// Ошибка возвращается, если уведомление не удалось записать хотя бы одному получателю
 func (n *Notification) Send(profiles ...primitive.ObjectID) error {
-	return utils.DB().UpdateSet(
-		collection,
-		bson.D{
-			// тут надо проверить условие для обновления
-			{Key: "_id", Value: bson.D{{Key: "$eq", Value: profiles}}},
-		},
-		bson.D{
-			{Key: "$push", Value: bson.D{{Key: "notifications", Value: bson.D{
-				{Key: "from", Value: n.From},
-				{Key: "target", Value: n.Target},
-				{Key: "key", Value: n.Key},
-				{Key: "time", Value: time.Now()},
-				{Key: "read", Value: false},
-			}}}},
-		},
-	)
+	report, err := n.Deliver(DefaultSendOptions, profiles...)
+	if err != nil {
+		return err
+	}
+
+	return report.Err()
 }
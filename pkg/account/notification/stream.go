@@ -0,0 +1,241 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	lastEventIDHeader = "Last-Event-ID"
+	lastEventIDParam  = "last_event_id"
+)
+
+var (
+	ErrStreamUnsupported = errors.New("соединение не поддерживает потоковую передачу")
+	ErrForbiddenOrigin   = errors.New("подключение с данного источника запрещено")
+
+	// Источники (схема и адрес, например https://example.com), с которых помимо адреса
+	// самого сервера разрешено подключение к WebSocket
+	AllowedOrigins []string
+
+	// Интервал отправки пустых сообщений для поддержания соединения
+	KeepAliveInterval = 30 * time.Second
+	// Колличество пропущенных уведомлений, загружаемых одним запросом при переподключении
+	ResumeLimit = 100
+
+	pingCodec = websocket.Codec{Marshal: func(interface{}) ([]byte, byte, error) {
+		return nil, websocket.PingFrame, nil
+	}}
+)
+
+// Поток уведомлений текущего пользователя через Server-Sent Events
+//
+// Каждое уведомление передается событием notification, идентификатор события - идентификатор уведомления.
+// При переподключении уведомления, созданные после идентификатора из заголовка Last-Event-ID
+// или параметра last_event_id, передаются перед новыми.
+// Требует авторизации через secure.StreamAuthMiddleware или secure.APIAuthMiddleware,
+// поток завершается, когда срок действия токена истекает или токен отзывается
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.ResponseError(w, http.StatusInternalServerError, ErrStreamUnsupported)
+		return
+	}
+
+	lastID, err := lastEventID(r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err = stream(r.Context(), secure.UserIDFromContext(r.Context()), lastID,
+		func(n Notification) error {
+			data, err := json.Marshal(n)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(w, "id: %s\nevent: notification\ndata: %s\n\n", n.ID.Hex(), data)
+			flusher.Flush()
+			return err
+		},
+		func() error {
+			_, err := fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+			return err
+		},
+	)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Поток уведомлений текущего пользователя через WebSocket
+//
+// Каждое уведомление передается текстовым сообщением в формате JSON, сообщения клиента игнорируются.
+// При переподключении уведомления, созданные после идентификатора из параметра last_event_id,
+// передаются перед новыми.
+// Требует авторизации через secure.WebSocketAuthMiddleware или secure.APIAuthMiddleware,
+// поток завершается, когда срок действия токена истекает или токен отзывается
+func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	lastID, err := lastEventID(r)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	profileID := secure.UserIDFromContext(r.Context())
+
+	websocket.Server{Handshake: checkOrigin, Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		// чтение требуется для обработки управляющих кадров и обнаружения закрытия соединения
+		go func() {
+			defer cancel()
+
+			var message []byte
+			for websocket.Message.Receive(ws, &message) == nil {
+			}
+		}()
+
+		err := stream(ctx, profileID, lastID,
+			func(n Notification) error { return websocket.JSON.Send(ws, n) },
+			func() error { return pingCodec.Send(ws, nil) },
+		)
+		if err != nil {
+			log.Println(err)
+		}
+	}}.ServeHTTP(w, r)
+}
+
+// Проверка источника подключения к WebSocket
+//
+// Браузер передает cookie с токеном при подключении с любого сайта, поэтому подключение
+// разрешается только с адреса самого сервера и источников из AllowedOrigins.
+// Запросы без заголовка Origin отправляются не браузером и не проверяются
+func checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+
+	if origin == nil {
+		return nil
+	}
+
+	if strings.EqualFold(origin.Host, r.Host) {
+		config.Origin = origin
+		return nil
+	}
+
+	for _, item := range AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(item, "/"), origin.Scheme+"://"+origin.Host) {
+			config.Origin = origin
+			return nil
+		}
+	}
+
+	return ErrForbiddenOrigin
+}
+
+// Передача уведомлений пользователя до завершения ctx
+//
+// Подписка оформляется до загрузки пропущенных уведомлений, поэтому уведомления,
+// отправленные во время загрузки, не теряются, а повторно полученные из хаба пропускаются.
+// Токен проверяется только при подключении, поэтому перед каждым keepalive он проверяется повторно:
+// поток завершается, как только срок действия токена истек или токен был отозван
+func stream(ctx context.Context, profileID primitive.ObjectID, lastID primitive.ObjectID, send func(Notification) error, keepalive func() error) error {
+	subscription := hub.Subscribe(profileID)
+	defer subscription.Close()
+
+	sent := map[primitive.ObjectID]bool{}
+
+	for !lastID.IsZero() {
+		notifications, err := Since(profileID, lastID, ResumeLimit)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range notifications {
+			err = send(item)
+			if err != nil {
+				return err
+			}
+
+			sent[item.ID] = true
+		}
+
+		if len(notifications) < ResumeLimit {
+			break
+		}
+
+		lastID = notifications[len(notifications)-1].ID
+	}
+
+	ticker := time.NewTicker(KeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := secure.CheckContextToken(ctx)
+			if err != nil {
+				return err
+			}
+
+			err = keepalive()
+			if err != nil {
+				return err
+			}
+		case item, ok := <-subscription.C:
+			if !ok {
+				return subscription.Err()
+			}
+
+			if sent[item.ID] {
+				continue
+			}
+
+			err := send(item)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func lastEventID(r *http.Request) (primitive.ObjectID, error) {
+	value := r.Header.Get(lastEventIDHeader)
+	if value == "" {
+		value = r.URL.Query().Get(lastEventIDParam)
+	}
+
+	if value == "" {
+		return primitive.NilObjectID, nil
+	}
+
+	return primitive.ObjectIDFromHex(value)
+}
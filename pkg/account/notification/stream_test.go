@@ -0,0 +1,101 @@
+package notification_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/notification"
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/net/websocket"
+)
+
+func Test_WebSocketOrigin(t *testing.T) {
+	recipient := primitive.NewObjectID()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := secure.ContextWithUser(r.Context(), recipient, "user", "")
+		notification.WebSocketHandler(w, r.WithContext(ctx))
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dial := func(origin string) error {
+		ws, err := websocket.Dial(url, "", origin)
+		if err == nil {
+			ws.Close()
+		}
+
+		return err
+	}
+
+	if err := dial(server.URL); err != nil {
+		t.Errorf("подключение с адреса сервера отклонено: %v", err)
+	}
+
+	if err := dial("https://evil.example"); err == nil {
+		t.Error("подключение с чужого источника разрешено")
+	}
+
+	notification.AllowedOrigins = []string{"https://app.example/"}
+	t.Cleanup(func() { notification.AllowedOrigins = nil })
+
+	if err := dial("https://app.example"); err != nil {
+		t.Errorf("подключение с разрешенного источника отклонено: %v", err)
+	}
+}
+
+func Test_StreamClosesOnExpiredToken(t *testing.T) {
+	interval := notification.KeepAliveInterval
+	notification.KeepAliveInterval = 50 * time.Millisecond
+	t.Cleanup(func() { notification.KeepAliveInterval = interval })
+
+	token, err := utils.JWT().GenerateToken(jwt.MapClaims{
+		"user_id":    primitive.NewObjectID().Hex(),
+		"user_group": "user",
+		"session":    "session",
+		"issued":     time.Now().UnixMilli(),
+		"exp":        time.Now().Add(time.Second).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(secure.StreamAuthMiddleware(http.HandlerFunc(notification.StreamHandler)))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("подключение с действующим токеном отклонено: %d", res.StatusCode)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, res.Body)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("поток не завершен после истечения срока действия токена")
+	}
+}
@@ -0,0 +1,62 @@
+package secure
+
+import (
+	"context"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	BannedGroup = "banned" // Группа заблокированных пользователей
+)
+
+// Информация о блокировке пользователя
+type Ban struct {
+	Reason    string             `json:"reason" bson:"reason"`                   // Причина блокировки
+	Moderator primitive.ObjectID `json:"moderator" bson:"moderator"`             // Пользователь, установивший блокировку
+	Since     time.Time          `json:"since" bson:"since"`                     // Время установки блокировки
+	Until     *time.Time         `json:"until,omitempty" bson:"until,omitempty"` // Время окончания блокировки (nil для бессрочной)
+	Group     string             `json:"group" bson:"group"`                     // Группа пользователя до блокировки
+}
+
+// Снятие блокировки пользователя
+//
+// Возвращает пользователю группу, в которой он состоял до блокировки, и отзывает его токены,
+// чтобы изменение вступило в силу немедленно. Если expiredOnly установлен,
+// блокировка будет снята только в случае если срок ее действия истек.
+// Возвращает признак того, что блокировка была снята
+func ReleaseBan(userID primitive.ObjectID, expiredOnly bool) (bool, error) {
+	filter := bson.D{
+		{Key: "_id", Value: userID},
+		{Key: "secure.access", Value: BannedGroup},
+	}
+
+	if expiredOnly {
+		filter = append(filter, bson.E{Key: "secure.ban.until", Value: bson.D{{Key: "$lte", Value: time.Now()}}})
+	}
+
+	var modified int64
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res, err := w.Collection(accountCollection).UpdateOne(ctx, filter, bson.A{
+			bson.D{{Key: "$set", Value: bson.D{
+				{Key: "secure.access", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$secure.ban.group", "user"}}}},
+			}}},
+			bson.D{{Key: "$unset", Value: "secure.ban"}},
+		})
+		if err != nil {
+			return err
+		}
+
+		modified = res.ModifiedCount
+		return nil
+	})
+	if err != nil || modified == 0 {
+		return false, err
+	}
+
+	return true, RevokeTokens(userID)
+}
@@ -10,11 +10,15 @@ var (
 	userIDCtxKey      = &ctxKeyUID{}
 	userGroupCtxKey   = &ctxKeyGID{}
 	userSessionCtxKey = &ctxKeySID{}
+	actorCtxKey       = &ctxKeyAID{}
+	tokenCtxKey       = &ctxKeyTID{}
 )
 
 type ctxKeyUID struct{}
 type ctxKeyGID struct{}
 type ctxKeySID struct{}
+type ctxKeyAID struct{}
+type ctxKeyTID struct{}
 
 // Обновление контекста для запроса
 func buildusercontext(ctx context.Context, userID primitive.ObjectID, userGroup string, userSession string) context.Context {
@@ -24,6 +28,14 @@ func buildusercontext(ctx context.Context, userID primitive.ObjectID, userGroup
 	return ctx
 }
 
+// Запись данных пользователя в контекст
+//
+// Используется, когда пользователь был авторизован в процессе обработки запроса,
+// например при создании гостевого аккаунта
+func ContextWithUser(ctx context.Context, userID primitive.ObjectID, userGroup string, userSession string) context.Context {
+	return buildusercontext(ctx, userID, userGroup, userSession)
+}
+
 // Получениеи идентификатора пользователя из контекста
 func UserIDFromContext(ctx context.Context) primitive.ObjectID {
 	return ctx.Value(userIDCtxKey).(primitive.ObjectID)
@@ -33,3 +45,26 @@ func UserIDFromContext(ctx context.Context) primitive.ObjectID {
 func UserGroupFromContext(ctx context.Context) string {
 	return ctx.Value(userGroupCtxKey).(string)
 }
+
+// Получение идентификатора администратора, выполняющего запрос от имени пользователя
+//
+// Второе значение сообщает, выполняется ли запрос в режиме имперсонации
+func ImpersonatorFromContext(ctx context.Context) (primitive.ObjectID, bool) {
+	actorID, ok := ctx.Value(actorCtxKey).(primitive.ObjectID)
+	return actorID, ok
+}
+
+// Повторная проверка токена, с которым был авторизован запрос
+//
+// Используется долгими соединениями (SSE, WebSocket), которые проходят авторизацию только при подключении:
+// вернет ErrUnvalidToken, если срок действия токена истек или токен был отозван.
+// Запросы без токена (гость, ContextWithUser) не проверяются
+func CheckContextToken(ctx context.Context) error {
+	tokenString, ok := ctx.Value(tokenCtxKey).(string)
+	if !ok {
+		return nil
+	}
+
+	_, err := checktoken(ctx, tokenString)
+	return err
+}
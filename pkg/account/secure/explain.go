@@ -0,0 +1,53 @@
+package secure
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	PrivilegesDebugLog    = "log"    // Запись отказов в доступе в журнал
+	PrivilegesDebugHeader = "header" // Запись разбора проверки в заголовок ответа и отказов в журнал
+
+	PrivilegesExplainHeader = "X-Privileges-Explain" // Заголовок с разбором проверки прав
+
+	privilegesDebugEnv = "PRIVILEGES_DEBUG"
+)
+
+var (
+	// Режим отладки проверки прав в middleware
+	//
+	// По умолчанию берется из переменной окружения PRIVILEGES_DEBUG, пустое значение отключает отладку.
+	// Разбор раскрывает правила доступа, поэтому режим не следует включать в production
+	PrivilegesDebug = os.Getenv(privilegesDebugEnv)
+)
+
+// Вывод разбора проверки прав в режиме отладки
+//
+// Вызывается до записи ответа, так как может установить заголовок
+func debugPrivileges(w http.ResponseWriter, r *http.Request, userID primitive.ObjectID, group, module string, privileges ...utils.PrivilegeType) {
+	if PrivilegesDebug != PrivilegesDebugLog && PrivilegesDebug != PrivilegesDebugHeader {
+		return
+	}
+
+	explanation := utils.Privileges().Explain(userID, group, module, privileges...)
+
+	data, err := json.Marshal(explanation)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if !explanation.Allowed {
+		log.Printf("доступ к %s %s запрещен (%s, %s, модуль %s): %s", r.Method, r.URL.Path, userID.Hex(), group, module, data)
+	}
+
+	if PrivilegesDebug == PrivilegesDebugHeader {
+		w.Header().Set(PrivilegesExplainHeader, string(data))
+	}
+}
@@ -0,0 +1,27 @@
+package secure
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Доступ к внутренним функциям пакета для тестов
+var (
+	CheckToken         = checktoken
+	ImpersonationToken = impersonationToken
+)
+
+// Запись отзыва токенов пользователя без обращения к базе данных
+func SetRevocation(userID primitive.ObjectID, revoked time.Time) {
+	revocations.set(userID, revoked.UnixMilli())
+}
+
+// Подмена получения группы администратора при проверке токена имперсонации,
+// возвращает функцию восстановления
+func SetActorGroup(lookup func(primitive.ObjectID) (string, error)) func() {
+	previous := actorGroup
+	actorGroup = lookup
+
+	return func() { actorGroup = previous }
+}
@@ -0,0 +1,34 @@
+package secure
+
+import (
+	"log"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	GuestGroup = "guest" // Группа анонимных посетителей и гостевых аккаунтов
+)
+
+// Обновление времени последней активности гостевого аккаунта
+//
+// Вызывается при обновлении токена гостя, по этому времени удаляются неактивные гостевые аккаунты
+func touchGuest(userID primitive.ObjectID) {
+	err := utils.DB().UpdateSet(
+		accountCollection,
+		bson.D{
+			{Key: "_id", Value: userID},
+			{Key: "secure.guest", Value: true},
+		},
+		bson.D{
+			{Key: "$set", Value: bson.D{{Key: "secure.seen", Value: time.Now()}}},
+		},
+	)
+
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,207 @@
+package secure
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ImpersonationModule    = "impersonation" // Модуль, привилегия PublicWrite которого разрешает вход от имени других пользователей
+	ImpersonationMaxTTL    = time.Hour       // Максимальное время действия токена имперсонации
+	impersonationAuditColl = "ImpersonationAudit"
+)
+
+var (
+	ErrImpersonationDenied = errors.New("недостаточно полномочий для входа от имени другого пользователя")
+	ErrSelfImpersonation   = errors.New("нельзя войти от имени самого себя")
+
+	// Получение текущей группы администратора при проверке токена имперсонации
+	actorGroup = accountGroup
+)
+
+func init() {
+	// права main не открывают вход от имени других пользователей, по умолчанию он доступен только группе admin
+	err := utils.RestrictModule(ImpersonationModule, map[string]utils.PrivilegeType{"admin": utils.PublicWrite})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Запись журнала имперсонации
+type ImpersonationRecord struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id"`          // Идентификатор записи
+	Actor   primitive.ObjectID `json:"actor" bson:"actor"`     // Пользователь, выполняющий вход от чужого имени
+	Target  primitive.ObjectID `json:"target" bson:"target"`   // Пользователь, от имени которого выполняется вход
+	Action  string             `json:"action" bson:"action"`   // Тип события (start или request)
+	Method  string             `json:"method" bson:"method"`   // HTTP метод запроса
+	Path    string             `json:"path" bson:"path"`       // Путь запроса
+	Address string             `json:"address" bson:"address"` // Адрес клиента
+	Time    time.Time          `json:"time" bson:"time"`       // Время события
+}
+
+// Вход от имени другого пользователя
+//
+// Доступен пользователям с привилегией PublicWrite в модуле ImpersonationModule
+// (по умолчанию только группе admin, правила main для модуля не применяются).
+// Группа целевого пользователя не должна иметь прав, которых нет у группы администратора.
+// Выпущенный токен содержит данные целевого пользователя и claim act с идентификатором администратора,
+// не привязан к сессии и не может быть обновлен, его время жизни ограничено ImpersonationMaxTTL.
+// Токен перестает действовать, если токены администратора отозваны или его группа больше не позволяет
+// вход от имени пользователя. Начало имперсонации и каждый запрос с таким токеном записываются в журнал
+func Impersonate(actorID primitive.ObjectID, actorGroup string, targetID primitive.ObjectID, ttl time.Duration) (string, error) {
+	if actorID == targetID {
+		return "", ErrSelfImpersonation
+	}
+
+	if ttl <= 0 || ttl > ImpersonationMaxTTL {
+		ttl = ImpersonationMaxTTL
+	}
+
+	targetGroup, err := accountGroup(targetID)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkImpersonation(actorID, actorGroup, targetGroup)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeImpersonationRecord(ImpersonationRecord{
+		Actor:  actorID,
+		Target: targetID,
+		Action: "start",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return impersonationToken(actorID, actorGroup, targetID, targetGroup, time.Now().Add(ttl))
+}
+
+// Проверка, что администратор группы actorGroup может войти от имени пользователя группы targetGroup
+func checkImpersonation(actorID primitive.ObjectID, actorGroup string, targetGroup string) error {
+	if !utils.Privileges().Check(actorID, actorGroup, ImpersonationModule, utils.PublicWrite) {
+		return ErrImpersonationDenied
+	}
+
+	if !utils.Privileges().Covers(actorGroup, targetGroup) {
+		return ErrImpersonationDenied
+	}
+
+	return nil
+}
+
+// Проверка администратора при каждом запросе с токеном имперсонации
+//
+// Отклоняет токен, если токены администратора отозваны после его выпуска (например при блокировке)
+// или текущая группа администратора больше не позволяет вход от имени пользователя
+func checkImpersonator(actorID primitive.ObjectID, targetGroup string, issued int64) error {
+	if revocations.revoked(actorID, issued) {
+		return ErrUnvalidToken
+	}
+
+	group, err := actorGroup(actorID)
+	if err != nil {
+		return err
+	}
+
+	return checkImpersonation(actorID, group, targetGroup)
+}
+
+// Выпуск токена имперсонации, действующего до expires
+func impersonationToken(actorID primitive.ObjectID, actorGroup string, targetID primitive.ObjectID, targetGroup string, expires time.Time) (string, error) {
+	return utils.JWT().GenerateToken(jwt.MapClaims{
+		"user_id":    targetID.Hex(),
+		"user_group": targetGroup,
+		"session":    "",
+		"act":        map[string]interface{}{"sub": actorID.Hex(), "group": actorGroup},
+		"issued":     time.Now().UnixMilli(),
+		"exp":        expires.Unix(),
+	})
+}
+
+// Получение журнала имперсонации для пользователя
+//
+// Возвращает записи, в которых пользователь выступал администратором или целевым пользователем
+func ImpersonationLog(userID primitive.ObjectID, skip int64, limit int64) ([]ImpersonationRecord, error) {
+	records := []ImpersonationRecord{}
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		cur, err := w.Collection(impersonationAuditColl).Find(
+			ctx,
+			bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "actor", Value: userID}},
+				bson.D{{Key: "target", Value: userID}},
+			}}},
+			options.Find().
+				SetSort(bson.D{{Key: "time", Value: -1}}).
+				SetSkip(skip).
+				SetLimit(limit),
+		)
+		if err != nil {
+			return err
+		}
+
+		return cur.All(ctx, &records)
+	})
+
+	return records, err
+}
+
+// Получение идентификатора администратора из claim act
+func parseActor(claims jwt.MapClaims) (primitive.ObjectID, bool) {
+	act, ok := claims["act"].(map[string]interface{})
+	if !ok {
+		return primitive.NilObjectID, false
+	}
+
+	sub, _ := act["sub"].(string)
+	actorID, err := primitive.ObjectIDFromHex(sub)
+	if err != nil {
+		return primitive.NilObjectID, false
+	}
+
+	return actorID, true
+}
+
+// Запись запроса, выполненного от имени другого пользователя
+func auditImpersonatedRequest(r *http.Request) {
+	actorID, ok := ImpersonatorFromContext(r.Context())
+	if !ok {
+		return
+	}
+
+	err := writeImpersonationRecord(ImpersonationRecord{
+		Actor:   actorID,
+		Target:  UserIDFromContext(r.Context()),
+		Action:  "request",
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Address: r.RemoteAddr,
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func writeImpersonationRecord(record ImpersonationRecord) error {
+	record.ID = primitive.NewObjectID()
+	record.Time = time.Now()
+
+	return utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		_, err := w.Collection(impersonationAuditColl).InsertOne(ctx, record)
+		return err
+	})
+}
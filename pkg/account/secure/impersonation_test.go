@@ -0,0 +1,93 @@
+package secure_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func adminActor(primitive.ObjectID) (string, error) {
+	return "admin", nil
+}
+
+func Test_ImpersonationTokenExpires(t *testing.T) {
+	t.Cleanup(secure.SetActorGroup(adminActor))
+	actorID, targetID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	token, err := secure.ImpersonationToken(actorID, "admin", targetID, "user", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, err := secure.CheckToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("действующий токен имперсонации отклонен: %v", err)
+	}
+
+	if impersonator, ok := secure.ImpersonatorFromContext(ctx); !ok || impersonator != actorID {
+		t.Errorf("в контексте отсутствует администратор %s", actorID.Hex())
+	}
+
+	token, err = secure.ImpersonationToken(actorID, "admin", targetID, "user", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = secure.CheckToken(context.Background(), token)
+	if err != secure.ErrUnvalidToken {
+		t.Errorf("истекший токен имперсонации принят, ошибка: %v", err)
+	}
+}
+
+func Test_ImpersonationIgnoresMainRules(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	if !utils.IsRestrictedModule(secure.ImpersonationModule) || !utils.IsRestrictedModule(secure.PrivilegesModule) {
+		t.Fatal("для административных модулей должна быть отключена подстановка правил main")
+	}
+
+	if !utils.Privileges().Check(id, "admin", secure.ImpersonationModule, utils.PublicWrite) {
+		t.Error("группа admin должна иметь право входа от имени других пользователей")
+	}
+
+	if utils.Privileges().Check(id, "moderator", secure.ImpersonationModule, utils.PublicWrite) {
+		t.Error("группа moderator не должна иметь право входа от имени других пользователей")
+	}
+}
+
+func Test_ImpersonationRevokedActor(t *testing.T) {
+	t.Cleanup(secure.SetActorGroup(adminActor))
+	actorID, targetID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	token, err := secure.ImpersonationToken(actorID, "admin", targetID, "user", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secure.SetRevocation(actorID, time.Now().Add(time.Second))
+
+	_, err = secure.CheckToken(context.Background(), token)
+	if err != secure.ErrUnvalidToken {
+		t.Errorf("токен имперсонации принят после отзыва токенов администратора, ошибка: %v", err)
+	}
+}
+
+func Test_ImpersonationActorGroup(t *testing.T) {
+	actorID, targetID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	token, err := secure.ImpersonationToken(actorID, "admin", targetID, "user", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(secure.SetActorGroup(func(primitive.ObjectID) (string, error) { return "moderator", nil }))
+
+	_, err = secure.CheckToken(context.Background(), token)
+	if err != secure.ErrUnvalidToken {
+		t.Errorf("токен имперсонации принят после смены группы администратора, ошибка: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package secure
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -31,28 +32,65 @@ func CheckPrivilegeMiddleware(privileges ...utils.PrivilegeType) func(http.Handl
 
 // Метод для проверки доступа к действию по модулю
 //
+// После проверки масок проверяются политики модуля (см. utils.Policy).
+// Разбор проверки доступен в режиме отладки (см. PrivilegesDebug).
 // В случае если у пользователя достаточно полномочий, его запрос перейдет дальше,
 // однако если полномочий недостаточно, запрос будет завершен с кодом 423
 func CheckModulePrivilegeMiddleware(module string, privileges ...utils.PrivilegeType) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
-			userID := UserIDFromContext(ctx)
-			userGroup := UserGroupFromContext(ctx)
-
-			if utils.Privileges().Check(userID, userGroup, module, privileges...) {
-				h.ServeHTTP(w, r)
-			} else {
-				utils.ResponseError(w, http.StatusLocked, ErrRequestLocked)
-			}
+			checkModulePrivileges(w, r, h, module, privileges)
 		})
 	}
 }
 
+// Метод для проверки доступа к действию по названиям прав модуля
+//
+// Например CheckModulePermissionMiddleware("blog", "publish"). Отдельное название нужно потому,
+// что CheckModulePrivilegeMiddleware принимает маски utils.PrivilegeType и используется существующими модулями,
+// а перегрузки функций в Go нет.
+// Названия разрешаются при создании middleware, поэтому права должны быть зарегистрированы
+// через utils.RegisterPermission заранее, например при инициализации модуля.
+// Неизвестное название - ошибка конфигурации и приводит к панике при монтировании маршрутов.
+// В остальном работает как CheckModulePrivilegeMiddleware
+func CheckModulePermissionMiddleware(module string, names ...string) func(http.Handler) http.Handler {
+	privileges := make([]utils.PrivilegeType, 0, len(names))
+	for _, name := range names {
+		mask, err := utils.Permission(module, name)
+		if err != nil {
+			log.Panic(fmt.Errorf("%w: %s.%s", err, module, name))
+		}
+
+		privileges = append(privileges, mask)
+	}
+
+	return CheckModulePrivilegeMiddleware(module, privileges...)
+}
+
+func checkModulePrivileges(w http.ResponseWriter, r *http.Request, h http.Handler, module string, privileges []utils.PrivilegeType) {
+	ctx := r.Context()
+	userID := UserIDFromContext(ctx)
+	userGroup := UserGroupFromContext(ctx)
+
+	debugPrivileges(w, r, userID, userGroup, module, privileges...)
+
+	if !utils.Privileges().Check(userID, userGroup, module, privileges...) {
+		utils.ResponseError(w, http.StatusLocked, ErrRequestLocked)
+		return
+	}
+
+	if !policiesAllow(w, r, module, nil, privileges...) {
+		return
+	}
+
+	h.ServeHTTP(w, r)
+}
+
 // Middleware для авторизации пользователя для сайта
 //
 // Проверит наличие токена в cookie запроса
 // В случае если токена нет запишет в контекст значения для гостя и продолжит выполнение
+// (постоянный гостевой аккаунт при необходимости создается через account.EnsureGuest)
 // В случае если токен не валиден проверит сессию
 //    если сессия валидна обновит токен и продолжит выполнение запроса с данными пользователя
 //    если нет удалит токен, запишет значения для гостя и продолжит выполнение
@@ -91,11 +129,18 @@ func SiteAuthMiddleware(next http.Handler) http.Handler {
 				return
 			}
 
+			if group == GuestGroup {
+				touchGuest(userID)
+			}
+
 			WriteTokenCookie(w, tokenString)
+			ctx = context.WithValue(ctx, tokenCtxKey, tokenString)
 			ctx = buildusercontext(ctx, userID, group, session)
 		}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		r = r.WithContext(ctx)
+		auditImpersonatedRequest(r)
+		next.ServeHTTP(w, r)
 	})
 }
 
@@ -118,11 +163,56 @@ func APIAuthMiddleware(next http.Handler) http.Handler {
 				return
 			}
 
-			utils.ResponseError(w, 412, err)
+			utils.ResponseError(w, 412, ErrUnvalidToken)
+			return
+		}
+
+		r = r.WithContext(ctx)
+		auditImpersonatedRequest(r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware проверки пользователя для потоковых соединений (SSE)
+//
+// Браузер не позволяет передать заголовок при открытии EventSource,
+// поэтому токен ищется в заголовке, затем в cookie.
+// Токен не обновляется: в случае отсутствия или ошибки проверки токена вернет 401 код и завершит выполнение запроса
+func StreamAuthMiddleware(next http.Handler) http.Handler {
+	return streamAuthMiddleware(next, false)
+}
+
+// Middleware проверки пользователя для подключений WebSocket
+//
+// Работает как StreamAuthMiddleware, но если токена нет в заголовке и cookie,
+// ищет его в параметре access_token запроса: клиент WebSocket в браузере не передает заголовки,
+// а cookie может быть недоступна для другого домена. Адрес запроса попадает в журналы
+// прокси и сервера, поэтому middleware следует использовать только для подключений WebSocket
+func WebSocketAuthMiddleware(next http.Handler) http.Handler {
+	return streamAuthMiddleware(next, true)
+}
+
+func streamAuthMiddleware(next http.Handler, fromQuery bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := r.Header.Get(accessTokenHeader)
+		if tokenString == "" {
+			if cookie, err := r.Cookie(accessTokenCookie); err == nil {
+				tokenString = cookie.Value
+			} else if fromQuery {
+				tokenString = r.URL.Query().Get(accessTokenCookie)
+			}
+		}
+
+		ctx, err := checktoken(r.Context(), tokenString)
+		if err != nil {
+			log.Println(err)
+			utils.ResponseError(w, http.StatusUnauthorized, ErrUnvalidToken)
 			return
 		}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		r = r.WithContext(ctx)
+		auditImpersonatedRequest(r)
+		next.ServeHTTP(w, r)
 	})
 }
 
@@ -170,15 +260,33 @@ func checktoken(ctx context.Context, tokenString string) (context.Context, error
 		return ctx, err
 	}
 
+	// токен был отозван, например после смены группы пользователя
+	if revocations.revoked(userID, parseIssued(claims)) {
+		return ctx, ErrUnvalidToken
+	}
+
+	// токен выпущен для входа администратора от имени пользователя
+	if actorID, ok := parseActor(claims); ok {
+		err = checkImpersonator(actorID, userGroup, parseIssued(claims))
+		if err != nil {
+			return ctx, ErrUnvalidToken
+		}
+
+		ctx = context.WithValue(ctx, actorCtxKey, actorID)
+	}
+
+	ctx = context.WithValue(ctx, tokenCtxKey, tokenString)
 	return buildusercontext(ctx, userID, userGroup, userSession), nil
 }
 
 // Установка значений гостя в контекст
 func userguestvalues(ctx context.Context) context.Context {
-	return buildusercontext(ctx, primitive.NilObjectID, "guest", "")
+	return buildusercontext(ctx, primitive.NilObjectID, GuestGroup, "")
 }
 
 // Проверка возможности обновления токена
+//
+// Возвращает данные для выпуска нового токена с актуальной группой пользователя
 func unverifiedchecktoken(tokenString string) (primitive.ObjectID, string, string, error) {
 	// Проверить на возможность обновления токена
 	claims, err := utils.JWT().ParseUnverified(tokenString)
@@ -186,11 +294,15 @@ func unverifiedchecktoken(tokenString string) (primitive.ObjectID, string, strin
 		return primitive.NilObjectID, "", "", err
 	}
 
-	userID, group, session, err := parseClaims(claims)
+	userID, _, session, err := parseClaims(claims)
+	if err != nil {
+		return primitive.NilObjectID, "", "", err
+	}
+
+	group, err := checkUser(userID, session)
 	if err != nil {
 		return primitive.NilObjectID, "", "", err
 	}
 
-	err = checkUser(userID, group, session)
-	return primitive.NilObjectID, "", "", err
+	return userID, group, session, nil
 }
@@ -0,0 +1,58 @@
+package secure_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_CheckModulePermissionMiddleware(t *testing.T) {
+	utils.MustRegisterPermission("middleware_test", "publish", 8)
+
+	handler := secure.CheckModulePermissionMiddleware("middleware_test", "publish")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(secure.ContextWithUser(r.Context(), primitive.NewObjectID(), "user", ""))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusLocked {
+		t.Errorf("ожидался код %d, получен %d", http.StatusLocked, w.Code)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("неизвестное название права не привело к панике при создании middleware")
+		}
+	}()
+
+	secure.CheckModulePermissionMiddleware("middleware_test", "unknown")
+}
+
+func Test_StreamAuthQueryToken(t *testing.T) {
+	token, err := secure.CreateNewUserToken(primitive.NewObjectID(), "user", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(middleware func(http.Handler) http.Handler) int {
+		r := httptest.NewRequest(http.MethodGet, "/?access_token="+token, nil)
+		w := httptest.NewRecorder()
+		middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := request(secure.StreamAuthMiddleware); code != http.StatusUnauthorized {
+		t.Errorf("токен из адреса принят для потока SSE, код %d", code)
+	}
+
+	if code := request(secure.WebSocketAuthMiddleware); code != http.StatusOK {
+		t.Errorf("токен из адреса отклонен для WebSocket, код %d", code)
+	}
+}
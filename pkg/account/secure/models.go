@@ -1,5 +1,7 @@
 package secure
 
+import "time"
+
 // Структура для описания сессии пользователя
 type Session struct {
 	Name string `bson:"name"` // Название сессии (является произвольным полем, однако корректно его использовать для описания сущьности с который был произведен вход)
@@ -8,7 +10,17 @@ type Session struct {
 
 // Структура для сохранения секретной информации о пользователе
 type Secure struct {
-	Access   string                 `json:"-" bson:"access"` // Идентификатор группы
-	AuthData map[string]interface{} `bson:"auth"`            // Данные для авторизации пользователя
-	Sessions []Session              `bson:"sessions"`        // Данные о сессиях пользователя
+	Access   string                 `json:"-" bson:"access"`    // Идентификатор группы
+	AuthData map[string]interface{} `bson:"auth,omitempty"`     // Данные для авторизации пользователя
+	Sessions []Session              `bson:"sessions"`           // Данные о сессиях пользователя
+	Guest    bool                   `bson:"guest,omitempty"`    // Признак гостевого аккаунта
+	Seen     time.Time              `bson:"seen,omitempty"`     // Время последней активности гостя
+	Ban      *Ban                   `bson:"ban,omitempty"`      // Информация о блокировке пользователя
+	Deletion *Deletion              `bson:"deletion,omitempty"` // Информация об отложенном удалении аккаунта
+}
+
+// Информация об отложенном удалении аккаунта
+type Deletion struct {
+	Requested time.Time `json:"requested" bson:"requested"` // Время запроса на удаление
+	Purge     time.Time `json:"purge" bson:"purge"`         // Время окончательного удаления
 }
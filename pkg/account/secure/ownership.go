@@ -0,0 +1,166 @@
+package secure
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Действие над ресурсом
+//
+// В зависимости от владельца ресурса действие проверяется правом Owner* или Public*
+type Action int
+
+const (
+	ActionRead Action = iota
+	ActionWrite
+	ActionUpdate
+	ActionDelete
+)
+
+var (
+	ErrResourceNotFound = errors.New("ресурс не найден")
+	ErrUnvalidResource  = errors.New("некорректный идентификатор ресурса")
+
+	resourceOwnerCtxKey = &ctxKeyROID{}
+)
+
+type ctxKeyROID struct{}
+
+// Право, соответствующее действию над своим или чужим ресурсом
+//
+// Для неизвестного действия возвращается пустая маска
+func (a Action) Privilege(owner bool) utils.PrivilegeType {
+	if a < ActionRead || a > ActionDelete {
+		return 0
+	}
+
+	privileges := [...][2]utils.PrivilegeType{
+		ActionRead:   {utils.PublicRead, utils.OwnerRead},
+		ActionWrite:  {utils.PublicWrite, utils.OwnerWrite},
+		ActionUpdate: {utils.PublicUpdate, utils.OwnerUpdate},
+		ActionDelete: {utils.PublicDelete, utils.OwnerDelete},
+	}
+
+	if owner {
+		return privileges[a][1]
+	}
+
+	return privileges[a][0]
+}
+
+// Функция получения владельца ресурса, к которому обращается запрос
+//
+// Если ресурс не существует, функция должна вернуть ErrResourceNotFound
+type OwnerResolver func(r *http.Request) (primitive.ObjectID, error)
+
+// Проверка права на действие над ресурсом
+//
+// Если пользователь из контекста является владельцем ресурса, проверяется право Owner*,
+// иначе Public*. Гость без аккаунта владельцем не считается.
+// Политики модуля данная функция не проверяет, для этого используется CheckOwnershipMiddleware.
+// Неизвестное действие всегда запрещено
+func Authorize(ctx context.Context, module string, action Action, ownerID primitive.ObjectID) bool {
+	privilege := actionPrivilege(ctx, action, ownerID)
+	if privilege == 0 {
+		return false
+	}
+
+	return utils.Privileges().Check(UserIDFromContext(ctx), UserGroupFromContext(ctx), module, privilege)
+}
+
+func actionPrivilege(ctx context.Context, action Action, ownerID primitive.ObjectID) utils.PrivilegeType {
+	userID := UserIDFromContext(ctx)
+	return action.Privilege(!userID.IsZero() && userID == ownerID)
+}
+
+// Middleware для проверки права на действие над ресурсом
+//
+// Владелец ресурса определяется через resolver. Если ресурс не найден, запрос будет завершен с кодом 404,
+// если полномочий недостаточно, с кодом 423. Политики модуля проверяются с атрибутом ресурса owner.
+// Идентификатор владельца записывается в контекст и доступен через ResourceOwnerFromContext
+func CheckOwnershipMiddleware(module string, action Action, resolver OwnerResolver) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ownerID, err := resolver(r)
+			switch err {
+			case nil:
+			case ErrResourceNotFound:
+				utils.ResponseError(w, http.StatusNotFound, err)
+				return
+			case ErrUnvalidResource:
+				utils.ResponseError(w, http.StatusBadRequest, err)
+				return
+			default:
+				log.Println(err)
+				utils.ResponseError(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			ctx := r.Context()
+			debugPrivileges(w, r, UserIDFromContext(ctx), UserGroupFromContext(ctx), module, actionPrivilege(ctx, action, ownerID))
+
+			if !Authorize(ctx, module, action, ownerID) {
+				utils.ResponseError(w, http.StatusLocked, ErrRequestLocked)
+				return
+			}
+
+			resource := map[string]interface{}{"owner": ownerID}
+			if !policiesAllow(w, r, module, resource, actionPrivilege(r.Context(), action, ownerID)) {
+				return
+			}
+
+			ctx = context.WithValue(ctx, resourceOwnerCtxKey, ownerID)
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Получение владельца ресурса, установленного CheckOwnershipMiddleware
+func ResourceOwnerFromContext(ctx context.Context) primitive.ObjectID {
+	ownerID, _ := ctx.Value(resourceOwnerCtxKey).(primitive.ObjectID)
+	return ownerID
+}
+
+// Получение владельца документа MongoDB
+//
+// Идентификатор документа берется из параметра маршрута chi с названием param,
+// владелец из поля field документа коллекции collection. Поле может быть вложенным,
+// например "secure.owner"
+func MongoOwnerResolver(collection, field, param string) OwnerResolver {
+	return func(r *http.Request) (primitive.ObjectID, error) {
+		id, err := primitive.ObjectIDFromHex(chi.URLParam(r, param))
+		if err != nil {
+			return primitive.NilObjectID, ErrUnvalidResource
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*3)
+		defer cancel()
+
+		raw, err := utils.DB().Collection(collection).FindOne(
+			ctx,
+			bson.D{{Key: "_id", Value: id}},
+			options.FindOne().SetProjection(bson.D{{Key: field, Value: 1}}),
+		).DecodeBytes()
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, ErrResourceNotFound
+		}
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+
+		// документ без владельца считается чужим для всех пользователей
+		ownerID, _ := raw.Lookup(strings.Split(field, ".")...).ObjectIDOK()
+		return ownerID, nil
+	}
+}
@@ -0,0 +1,24 @@
+package secure_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_AuthorizeUnknownAction(t *testing.T) {
+	action := secure.Action(42)
+
+	if action.Privilege(true) != 0 || action.Privilege(false) != 0 {
+		t.Error("неизвестное действие должно давать пустую маску")
+	}
+
+	id := primitive.NewObjectID()
+	ctx := secure.ContextWithUser(context.Background(), id, "admin", "")
+
+	if secure.Authorize(ctx, "blog", action, id) {
+		t.Error("неизвестное действие разрешено")
+	}
+}
@@ -0,0 +1,65 @@
+package secure
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Итоговые права пользователя для клиентских приложений
+type EffectivePermissions struct {
+	User    primitive.ObjectID         `json:"user"`    // Идентификатор пользователя
+	Group   string                     `json:"group"`   // Группа пользователя
+	Modules map[string]map[string]bool `json:"modules"` // Флаги прав по модулям
+}
+
+// Получение итоговых прав пользователя из контекста запроса
+func EffectivePermissionsFromContext(r *http.Request) EffectivePermissions {
+	ctx := r.Context()
+	userID := UserIDFromContext(ctx)
+	group := UserGroupFromContext(ctx)
+
+	return EffectivePermissions{
+		User:    userID,
+		Group:   group,
+		Modules: utils.Privileges().Effective(userID, group),
+	}
+}
+
+// Обработчик запроса итоговых прав текущего пользователя
+//
+// Подключается после APIAuthMiddleware или SiteAuthMiddleware. Ответ содержит ETag,
+// который изменяется вместе с правами пользователя, при совпадении If-None-Match возвращается код 304
+func EffectivePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(EffectivePermissionsFromContext(r))
+	if err != nil {
+		log.Println(err)
+		utils.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	sum := sha1.Sum(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Vary", accessTokenHeader+", Cookie")
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,124 @@
+package secure
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	principalAttributes = []namedPrincipalAttributes{}
+)
+
+// Функция получения дополнительных атрибутов пользователя для политик доступа
+//
+// Например, модуль блога может вернуть разделы, назначенные модератору
+type PrincipalAttributes func(ctx context.Context, userID primitive.ObjectID) (map[string]interface{}, error)
+
+type namedPrincipalAttributes struct {
+	name       string
+	attributes PrincipalAttributes
+}
+
+// Регистрация источника атрибутов пользователя
+//
+// Атрибуты доступны в условиях политик по пути "principal.<name>.<атрибут>".
+// Повторная регистрация с тем же именем заменяет предыдущую
+func RegisterPrincipalAttributes(name string, attributes PrincipalAttributes) {
+	for i, item := range principalAttributes {
+		if item.name == name {
+			principalAttributes[i].attributes = attributes
+			return
+		}
+	}
+
+	principalAttributes = append(principalAttributes, namedPrincipalAttributes{name: name, attributes: attributes})
+}
+
+// Сборка атрибутов запроса для проверки политик доступа
+//
+// Пользователь описывается атрибутами id, group, impersonated и зарегистрированными источниками,
+// окружение - атрибутами ip, time, hour, weekday, method и path
+func NewPolicyRequest(r *http.Request, resource map[string]interface{}) (utils.PolicyRequest, error) {
+	ctx := r.Context()
+	userID := UserIDFromContext(ctx)
+	_, impersonated := ImpersonatorFromContext(ctx)
+
+	principal := map[string]interface{}{
+		"id":           userID,
+		"group":        UserGroupFromContext(ctx),
+		"impersonated": impersonated,
+	}
+
+	if !userID.IsZero() {
+		for _, item := range principalAttributes {
+			attributes, err := item.attributes(ctx, userID)
+			if err != nil {
+				return utils.PolicyRequest{}, err
+			}
+
+			principal[item.name] = attributes
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	now := time.Now()
+
+	return utils.PolicyRequest{
+		Principal: principal,
+		Resource:  resource,
+		Environment: map[string]interface{}{
+			"ip":      ip,
+			"time":    now,
+			"hour":    now.Hour(),
+			"weekday": int(now.Weekday()),
+			"method":  r.Method,
+			"path":    r.URL.Path,
+		},
+	}, nil
+}
+
+// Проверка политик модуля в middleware
+//
+// В случае отказа завершает запрос с кодом 423, в случае ошибки - с кодом 500
+func policiesAllow(w http.ResponseWriter, r *http.Request, module string, resource map[string]interface{}, privileges ...utils.PrivilegeType) bool {
+	err := checkRequestPolicies(r, module, resource, privileges...)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, utils.ErrPolicyDenied):
+		log.Println(err)
+		utils.ResponseError(w, http.StatusLocked, ErrRequestLocked)
+	default:
+		log.Println(err)
+		utils.ResponseError(w, http.StatusInternalServerError, err)
+	}
+
+	return false
+}
+
+// Проверка политик модуля для запроса
+//
+// Атрибуты пользователя собираются только если в модуле заданы политики
+func checkRequestPolicies(r *http.Request, module string, resource map[string]interface{}, privileges ...utils.PrivilegeType) error {
+	if len(utils.Privileges().Policies(module)) == 0 {
+		return nil
+	}
+
+	request, err := NewPolicyRequest(r, resource)
+	if err != nil {
+		return err
+	}
+
+	return utils.Privileges().CheckPolicies(UserGroupFromContext(r.Context()), module, request, privileges...)
+}
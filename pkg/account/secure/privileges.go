@@ -0,0 +1,394 @@
+package secure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	PrivilegesModule    = "privileges" // Модуль, привилегия PublicWrite которого разрешает управление правами доступа
+	privilegesAuditColl = "PrivilegesChangeAudit"
+)
+
+var (
+	ErrUnvalidGrant = errors.New("некорректный запрос на изменение прав доступа")
+)
+
+func init() {
+	// права main не открывают управление правами доступа, по умолчанию оно доступно только группе admin
+	err := utils.RestrictModule(PrivilegesModule, map[string]utils.PrivilegeType{"admin": utils.PublicWrite})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Правила модуля в читаемом виде
+type ModuleRule struct {
+	Mask        utils.PrivilegeType `json:"mask"`              // Маска прав
+	Permissions []string            `json:"permissions"`       // Названия установленных прав
+	Unknown     utils.PrivilegeType `json:"unknown,omitempty"` // Биты маски без зарегистрированных названий
+}
+
+// Описание группы для API управления правами
+type GroupPrivileges struct {
+	Name      string                `json:"name"`                // Название группы
+	Parents   []string              `json:"parents"`             // Родительские группы
+	Ancestors []string              `json:"ancestors,omitempty"` // Все группы, правила которых наследуются
+	Rules     map[string]ModuleRule `json:"rules"`               // Собственные правила группы
+	Effective map[string]ModuleRule `json:"effective,omitempty"` // Итоговые правила с учетом наследования
+}
+
+// Описание персональных правил пользователя для API управления правами
+type UserPrivileges struct {
+	ID    primitive.ObjectID    `json:"id"`    // Идентификатор пользователя
+	Rules map[string]ModuleRule `json:"rules"` // Персональные правила пользователя
+}
+
+// Описание модуля для API управления правами
+type ModulePermissions struct {
+	Name        string   `json:"name"`        // Название модуля
+	Permissions []string `json:"permissions"` // Названия прав, доступных в модуле
+}
+
+// Запрос на выдачу или отзыв прав
+//
+// Должна быть указана группа или пользователь
+type PrivilegeGrant struct {
+	Group       string   `json:"group,omitempty"`
+	User        string   `json:"user,omitempty"`
+	Module      string   `json:"module"`
+	Permissions []string `json:"permissions"`
+}
+
+// Запись журнала изменений правил доступа через API управления правами
+type PrivilegesChangeRecord struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`                                      // Идентификатор записи
+	Actor       primitive.ObjectID `json:"actor" bson:"actor"`                                 // Пользователь, изменивший правила
+	Action      string             `json:"action" bson:"action"`                               // Тип изменения (grant, revoke или parents)
+	Group       string             `json:"group,omitempty" bson:"group,omitempty"`             // Измененная группа
+	User        string             `json:"user,omitempty" bson:"user,omitempty"`               // Пользователь, правила которого изменены
+	Module      string             `json:"module,omitempty" bson:"module,omitempty"`           // Модуль
+	Permissions []string           `json:"permissions,omitempty" bson:"permissions,omitempty"` // Выданные или отозванные права
+	Parents     []string           `json:"parents,omitempty" bson:"parents,omitempty"`         // Установленные родительские группы
+	Address     string             `json:"address" bson:"address"`                             // Адрес клиента
+	Time        time.Time          `json:"time" bson:"time"`                                   // Время изменения
+}
+
+// Монтирование API управления правами доступа
+//
+// Все методы требуют авторизации через APIAuthMiddleware и привилегии PublicWrite в модуле PrivilegesModule
+// (по умолчанию только группа admin, правила main для модуля не применяются):
+//
+//	GET  /groups                   - список групп с собственными правилами
+//	GET  /groups/{group}           - группа с итоговыми правилами по модулям
+//	PUT  /groups/{group}/parents   - установка родительских групп ({"parents": [...]})
+//	GET  /modules                  - модули и доступные в них права
+//	GET  /users                    - пользователи с персональными правилами
+//	GET  /users/{user}             - персональные правила пользователя
+//	POST /grant                    - выдача прав (PrivilegeGrant)
+//	POST /revoke                   - отзыв прав (PrivilegeGrant)
+//
+// Каждое изменение правил записывается в журнал (см. PrivilegesChangeLog)
+func MountPrivilegesAPI(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(APIAuthMiddleware)
+		r.Use(CheckModulePrivilegeMiddleware(PrivilegesModule, utils.PublicWrite))
+
+		r.Get("/groups", privilegesGroupsHandler)
+		r.Get("/groups/{group}", privilegesGroupHandler)
+		r.Put("/groups/{group}/parents", privilegesParentsHandler)
+		r.Get("/modules", privilegesModulesHandler)
+		r.Get("/users", privilegesUsersHandler)
+		r.Get("/users/{user}", privilegesUserHandler)
+		r.Post("/grant", privilegesGrantHandler(true))
+		r.Post("/revoke", privilegesGrantHandler(false))
+	})
+}
+
+func privilegesGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups := []GroupPrivileges{}
+	for _, name := range utils.Privileges().Groups() {
+		groups = append(groups, GroupPrivileges{
+			Name:    name,
+			Parents: utils.Privileges().Parents(name),
+			Rules:   describeRules(utils.Privileges().GroupRules(name)),
+		})
+	}
+
+	utils.Response(w, http.StatusOK, groups)
+}
+
+func privilegesGroupHandler(w http.ResponseWriter, r *http.Request) {
+	responseGroupPrivileges(w, chi.URLParam(r, "group"))
+}
+
+func responseGroupPrivileges(w http.ResponseWriter, name string) {
+	if !utils.Privileges().HasGroup(name) {
+		utils.ResponseError(w, http.StatusNotFound, utils.ErrUnvalidGroup)
+		return
+	}
+
+	effective := map[string]utils.PrivilegeType{}
+	for _, module := range utils.Privileges().Modules() {
+		mask := utils.Privileges().EffectiveMask(name, module)
+		if mask != 0 {
+			effective[module] = mask
+		}
+	}
+
+	utils.Response(w, http.StatusOK, GroupPrivileges{
+		Name:      name,
+		Parents:   utils.Privileges().Parents(name),
+		Ancestors: utils.Privileges().Ancestors(name)[1:],
+		Rules:     describeRules(utils.Privileges().GroupRules(name)),
+		Effective: describeRules(effective),
+	})
+}
+
+func privilegesParentsHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Parents []string `json:"parents"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = utils.Privileges().SetParents(chi.URLParam(r, "group"), body.Parents...)
+	if err != nil {
+		responsePrivilegesError(w, err)
+		return
+	}
+
+	auditPrivilegesChange(r, PrivilegesChangeRecord{
+		Action:  "parents",
+		Group:   chi.URLParam(r, "group"),
+		Parents: body.Parents,
+	})
+
+	responseGroupPrivileges(w, chi.URLParam(r, "group"))
+}
+
+func privilegesModulesHandler(w http.ResponseWriter, r *http.Request) {
+	names := append(utils.Privileges().Modules(), utils.PermissionModules()...)
+	known := map[string]bool{}
+
+	modules := []ModulePermissions{}
+	for _, name := range names {
+		if known[name] {
+			continue
+		}
+
+		known[name] = true
+		permissions := []string{}
+		for permission := range utils.Permissions(name) {
+			permissions = append(permissions, permission)
+		}
+
+		sort.Strings(permissions)
+		modules = append(modules, ModulePermissions{Name: name, Permissions: permissions})
+	}
+
+	utils.Response(w, http.StatusOK, modules)
+}
+
+func privilegesUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users := []UserPrivileges{}
+	for _, id := range utils.Privileges().Users() {
+		users = append(users, UserPrivileges{ID: id, Rules: describeRules(utils.Privileges().UserRules(id))})
+	}
+
+	utils.Response(w, http.StatusOK, users)
+}
+
+func privilegesUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "user"))
+	if err != nil {
+		utils.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	responseUserPrivileges(w, id)
+}
+
+func responseUserPrivileges(w http.ResponseWriter, id primitive.ObjectID) {
+	utils.Response(w, http.StatusOK, UserPrivileges{ID: id, Rules: describeRules(utils.Privileges().UserRules(id))})
+}
+
+func privilegesGrantHandler(grant bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := PrivilegeGrant{}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			utils.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		err = ApplyPrivilegeGrant(body, grant)
+		if err != nil {
+			responsePrivilegesError(w, err)
+			return
+		}
+
+		record := PrivilegesChangeRecord{
+			Action:      "revoke",
+			Group:       body.Group,
+			User:        body.User,
+			Module:      body.Module,
+			Permissions: body.Permissions,
+		}
+
+		if grant {
+			record.Action = "grant"
+		}
+
+		auditPrivilegesChange(r, record)
+
+		if body.User != "" {
+			id, _ := primitive.ObjectIDFromHex(body.User)
+			responseUserPrivileges(w, id)
+			return
+		}
+
+		responseGroupPrivileges(w, body.Group)
+	}
+}
+
+// Выдача (grant = true) или отзыв прав по запросу
+//
+// Названия прав должны быть зарегистрированы в модуле, группа не может быть идентификатором пользователя.
+// Права пользователя выдаются в дополнение к правам, которые он уже получает по правилам своей группы,
+// а отзыв снимает права только с персонального правила (см. utils.PrivilegesStorage.ExtendUser и ReduceUser)
+func ApplyPrivilegeGrant(body PrivilegeGrant, grant bool) error {
+	if (body.Group == "") == (body.User == "") || len(body.Permissions) == 0 {
+		return ErrUnvalidGrant
+	}
+
+	if body.Module == "" || strings.Contains(body.Module, ".") {
+		return ErrUnvalidGrant
+	}
+
+	privileges := []utils.PrivilegeType{}
+	for _, name := range body.Permissions {
+		mask, err := utils.Permission(body.Module, name)
+		if err != nil {
+			return err
+		}
+
+		privileges = append(privileges, mask)
+	}
+
+	if body.User != "" {
+		id, err := primitive.ObjectIDFromHex(body.User)
+		if err != nil {
+			return ErrUnvalidGrant
+		}
+
+		if !grant {
+			return utils.Privileges().ReduceUser(id, body.Module, privileges...)
+		}
+
+		group, err := accountGroup(id)
+		if err != nil {
+			return err
+		}
+
+		return utils.Privileges().ExtendUser(id, group, body.Module, privileges...)
+	}
+
+	if strings.Contains(body.Group, ".") || primitive.IsValidObjectID(body.Group) {
+		return utils.ErrUnvalidGroup
+	}
+
+	if grant {
+		return utils.Privileges().SetGroup(body.Group, body.Module, privileges...)
+	}
+
+	return utils.Privileges().UnsetGroup(body.Group, body.Module, privileges...)
+}
+
+// Получение журнала изменений правил доступа
+//
+// Записи возвращаются от новых к старым
+func PrivilegesChangeLog(skip int64, limit int64) ([]PrivilegesChangeRecord, error) {
+	records := []PrivilegesChangeRecord{}
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		cur, err := w.Collection(privilegesAuditColl).Find(
+			ctx,
+			bson.D{},
+			options.Find().
+				SetSort(bson.D{{Key: "time", Value: -1}}).
+				SetSkip(skip).
+				SetLimit(limit),
+		)
+		if err != nil {
+			return err
+		}
+
+		return cur.All(ctx, &records)
+	})
+
+	return records, err
+}
+
+// Запись изменения правил, выполненного по запросу
+//
+// Правила к этому моменту уже изменены, поэтому ошибка записи журнала только выводится в лог
+func auditPrivilegesChange(r *http.Request, record PrivilegesChangeRecord) {
+	record.ID = primitive.NewObjectID()
+	record.Actor = UserIDFromContext(r.Context())
+	record.Address = r.RemoteAddr
+	record.Time = time.Now()
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		_, err := w.Collection(privilegesAuditColl).InsertOne(ctx, record)
+		return err
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func describeRules(rules map[string]utils.PrivilegeType) map[string]ModuleRule {
+	result := make(map[string]ModuleRule, len(rules))
+	for module, mask := range rules {
+		names, unknown := utils.PermissionNames(module, mask)
+		result[module] = ModuleRule{Mask: mask, Permissions: names, Unknown: unknown}
+	}
+
+	return result
+}
+
+func responsePrivilegesError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		utils.ResponseError(w, http.StatusNotFound, err)
+	case errors.Is(err, utils.ErrPrivilegesConflict):
+		utils.ResponseError(w, http.StatusConflict, err)
+	case errors.Is(err, ErrUnvalidGrant),
+		errors.Is(err, utils.ErrUnknownPermission),
+		errors.Is(err, utils.ErrUnvalidGroup),
+		errors.Is(err, utils.ErrPrivilegesCycle):
+		utils.ResponseError(w, http.StatusBadRequest, err)
+	default:
+		log.Println(err)
+		utils.ResponseError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,163 @@
+package secure
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	tokenTTL = time.Hour
+
+	// Время хранения отзыва: токены, выпущенные до отзыва, к этому времени истекают (exp),
+	// запас учитывает расхождение часов экземпляров приложения.
+	// Время жизни токенов имперсонации (ImpersonationMaxTTL) не должно превышать tokenTTL
+	revocationTTL = tokenTTL + time.Minute
+)
+
+var (
+	revocations = &revocationCache{items: map[primitive.ObjectID]int64{}}
+)
+
+// Кеш отзывов токенов
+//
+// Хранит для пользователя время (в миллисекундах), до которого выпущенные токены считаются недействительными.
+// Записи старше revocationTTL не нужны, так как такие токены отклоняются проверкой exp
+type revocationCache struct {
+	mutex sync.RWMutex
+	items map[primitive.ObjectID]int64
+}
+
+func (rc *revocationCache) set(userID primitive.ObjectID, revoked int64) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if rc.items[userID] < revoked {
+		rc.items[userID] = revoked
+	}
+
+	border := time.Now().Add(-revocationTTL).UnixMilli()
+	for id, value := range rc.items {
+		if value < border {
+			delete(rc.items, id)
+		}
+	}
+}
+
+func (rc *revocationCache) revoked(userID primitive.ObjectID, issued int64) bool {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+
+	value, ok := rc.items[userID]
+	return ok && issued < value
+}
+
+// Отзыв токенов пользователя
+//
+// Все выпущенные ранее токены пользователя перестают проходить проверку,
+// при этом сессии сохраняются: при следующем обновлении токен будет выпущен заново
+// с актуальной группой пользователя. Используется, когда права пользователя изменились
+// и изменения должны вступить в силу немедленно
+func RevokeTokens(userID primitive.ObjectID) error {
+	now := time.Now()
+
+	err := utils.DB().UpdateObj(userID, accountCollection, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "secure.revoked", Value: now}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	revocations.set(userID, now.UnixMilli())
+	return nil
+}
+
+// Синхронизация отзывов токенов между экземплярами приложения
+//
+// Сразу после запуска и далее каждые interval загружает из базы отзывы токенов,
+// сделанные другими экземплярами или до перезапуска приложения.
+// Возвращает функцию для остановки синхронизации
+func SyncRevocations(interval time.Duration) func() {
+	stop := make(chan struct{})
+
+	go func() {
+		err := loadRevocations(time.Now().Add(-revocationTTL))
+		if err != nil {
+			log.Println(err)
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := loadRevocations(time.Now().Add(-revocationTTL))
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
+
+func loadRevocations(since time.Time) error {
+	return utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		cur, err := w.Collection(accountCollection).Find(
+			ctx,
+			bson.D{{Key: "secure.revoked", Value: bson.D{{Key: "$gt", Value: since}}}},
+			options.Find().SetProjection(bson.D{{Key: "secure.revoked", Value: 1}}),
+		)
+		if err != nil {
+			return err
+		}
+
+		items := []struct {
+			ID     primitive.ObjectID `bson:"_id"`
+			Secure struct {
+				Revoked time.Time `bson:"revoked"`
+			} `bson:"secure"`
+		}{}
+
+		err = cur.All(ctx, &items)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			revocations.set(item.ID, item.Secure.Revoked.UnixMilli())
+		}
+
+		return nil
+	})
+}
+
+// Время выпуска токена в миллисекундах
+//
+// Для токенов, выпущенных до появления данного поля, возвращает 0
+func parseIssued(claims jwt.MapClaims) int64 {
+	switch value := claims["issued"].(type) {
+	case float64:
+		return int64(value)
+	case int64:
+		return value
+	case json.Number:
+		i, _ := value.Int64()
+		return i
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,78 @@
+package secure_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account/secure"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func userToken(t *testing.T, userID primitive.ObjectID, issued time.Time) string {
+	token, err := utils.JWT().GenerateToken(jwt.MapClaims{
+		"user_id":    userID.Hex(),
+		"user_group": "admin",
+		"session":    "session",
+		"issued":     issued.UnixMilli(),
+		"exp":        issued.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func Test_RevokedTokenRejected(t *testing.T) {
+	userID := primitive.NewObjectID()
+	token := userToken(t, userID, time.Now().Add(-time.Minute))
+
+	_, err := secure.CheckToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("действующий токен отклонен: %v", err)
+	}
+
+	secure.SetRevocation(userID, time.Now())
+
+	_, err = secure.CheckToken(context.Background(), token)
+	if err != secure.ErrUnvalidToken {
+		t.Errorf("отозванный токен принят, ошибка: %v", err)
+	}
+}
+
+func Test_RevokedTokenRejectedAfterPrune(t *testing.T) {
+	userID := primitive.NewObjectID()
+	revoked := time.Now().Add(-2 * time.Hour)
+	token := userToken(t, userID, revoked.Add(-time.Minute))
+
+	secure.SetRevocation(userID, revoked)
+	// запись отзыва другого пользователя удаляет устаревшие отзывы
+	secure.SetRevocation(primitive.NewObjectID(), time.Now())
+
+	_, err := secure.CheckToken(context.Background(), token)
+	if err != secure.ErrUnvalidToken {
+		t.Errorf("токен, выпущенный до удаленного отзыва, принят, ошибка: %v", err)
+	}
+}
+
+func Test_CheckContextTokenRevoked(t *testing.T) {
+	userID := primitive.NewObjectID()
+
+	ctx, err := secure.CheckToken(context.Background(), userToken(t, userID, time.Now().Add(-time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = secure.CheckContextToken(ctx); err != nil {
+		t.Fatalf("действующий токен отклонен при повторной проверке: %v", err)
+	}
+
+	secure.SetRevocation(userID, time.Now())
+
+	if err = secure.CheckContextToken(ctx); err != secure.ErrUnvalidToken {
+		t.Errorf("отозванный токен принят при повторной проверке, ошибка: %v", err)
+	}
+}
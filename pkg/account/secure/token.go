@@ -10,6 +10,8 @@ import (
 	"github.com/golang-jwt/jwt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -19,21 +21,24 @@ var (
 	ErrUnvalidGroup   = errors.New("признак группы неверен или отсутствует")
 	ErrNoSessionClaim = errors.New("в токене отсутствует ключ сессии")
 	ErrUnvalidSession = errors.New("клюх сессии неверен или отсутствует")
+	ErrUserNotFound   = errors.New("пользователь не найден")
 )
 
 // Обновление токена пользователя для доступа к ресурсам
+//
+// Новый токен выпускается с группой, которая установлена пользователю в базе на момент обновления
 func RefreshUserToken(tokenString string) (string, error) {
 	claims, err := utils.JWT().ParseUnverified(tokenString)
 	if err != nil {
 		return "", err
 	}
 
-	userID, group, sessionKey, err := parseClaims(claims)
+	userID, _, sessionKey, err := parseClaims(claims)
 	if err != nil {
 		return "", err
 	}
 
-	err = checkUser(userID, group, sessionKey)
+	group, err := checkUser(userID, sessionKey)
 	if err != nil {
 		return "", err
 	}
@@ -46,7 +51,8 @@ func CreateNewUserToken(userID primitive.ObjectID, group string, sessionKey stri
 		"user_id":    userID.Hex(),
 		"user_group": group,
 		"session":    sessionKey,
-		"exp":        time.Now().Add(time.Hour),
+		"issued":     time.Now().UnixMilli(),
+		"exp":        time.Now().Add(tokenTTL).Unix(),
 	})
 }
 
@@ -64,7 +70,7 @@ func parseClaims(claims jwt.MapClaims) (primitive.ObjectID, string, string, erro
 		return primitive.NilObjectID, "", "", err
 	}
 
-	groupClaim, ok := claims["group"]
+	groupClaim, ok := claims["user_group"]
 	if !ok {
 		return primitive.NilObjectID, "", "", ErrNoGroupClaim
 	}
@@ -85,19 +91,81 @@ func parseClaims(claims jwt.MapClaims) (primitive.ObjectID, string, string, erro
 	return userID, group, session, nil
 }
 
-func checkUser(userID primitive.ObjectID, group string, sessionKey string) error {
-	return utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+// Проверка сессии пользователя
+//
+// Возвращает актуальную группу пользователя, снимая блокировку, если срок ее действия истек.
+// Запись в базу данных выполняется только для пользователя с истекшей блокировкой
+func checkUser(userID primitive.ObjectID, sessionKey string) (string, error) {
+	user := struct {
+		Secure struct {
+			Access string `bson:"access"`
+			Ban    *Ban   `bson:"ban"`
+		} `bson:"secure"`
+	}{}
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
 		c := w.Collection(accountCollection)
 
 		res := c.FindOne(
 			ctx,
 			bson.D{
 				{Key: "_id", Value: userID},
-				{Key: "secure.access", Value: group},
 				{Key: "secure.sessions.key", Value: sessionKey},
 			},
+			options.FindOne().SetProjection(bson.D{
+				{Key: "secure.access", Value: 1},
+				{Key: "secure.ban", Value: 1},
+			}),
+		)
+
+		return res.Decode(&user)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ban := user.Secure.Ban
+	if user.Secure.Access != BannedGroup || ban == nil || ban.Until == nil || ban.Until.After(time.Now()) {
+		return user.Secure.Access, nil
+	}
+
+	released, err := ReleaseBan(userID, true)
+	if err != nil {
+		return "", err
+	}
+
+	// блокировку уже снял StartBanExpiry или другой запрос
+	if !released {
+		return accountGroup(userID)
+	}
+
+	if ban.Group == "" {
+		return "user", nil
+	}
+
+	return ban.Group, nil
+}
+
+// Получение текущей группы пользователя
+func accountGroup(userID primitive.ObjectID) (string, error) {
+	user := struct {
+		Secure struct {
+			Access string `bson:"access"`
+		} `bson:"secure"`
+	}{}
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		res := w.Collection(accountCollection).FindOne(
+			ctx,
+			bson.D{{Key: "_id", Value: userID}},
+			options.FindOne().SetProjection(bson.D{{Key: "secure.access", Value: 1}}),
 		)
 
-		return res.Err()
+		return res.Decode(&user)
 	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", ErrUserNotFound
+	}
+
+	return user.Secure.Access, err
 }
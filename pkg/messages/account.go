@@ -0,0 +1,129 @@
+package messages
+
+import (
+	"context"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/account"
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"github.com/ReanSn0w/mongo-monkey/wrap"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func init() {
+	account.RegisterExporter("messages", exportMessages)
+	account.RegisterDeletionHook("messages", anonymizeMessages)
+}
+
+// Сообщение пользователя в выгрузке данных
+type exportedMessage struct {
+	ChatID    primitive.ObjectID `json:"chat" bson:"chat"`
+	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
+	Text      string             `json:"text" bson:"text"`
+	Media     []utils.Media      `json:"media" bson:"media"`
+}
+
+// Сообщения пользователя в выгрузке данных
+type exportedMessages struct {
+	Messages     []exportedMessage `json:"messages"`       // Сообщения, отправленные пользователем
+	Unattributed int               `json:"unattributed"`   // Количество сообщений без автора в чатах пользователя
+	Note         string            `json:"note,omitempty"` // Пояснение для сообщений без автора
+}
+
+// Выгрузка всех сообщений, отправленных пользователем
+//
+// Сообщения, сохраненные до появления поля Sender, не содержат автора: восстановить его
+// по данным чата нельзя, поэтому такие сообщения в выгрузку не входят,
+// а их количество в чатах пользователя указывается в выгрузке вместе с пояснением
+func exportMessages(userID primitive.ObjectID) (interface{}, error) {
+	export := exportedMessages{Messages: []exportedMessage{}}
+
+	err := utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		c := w.Collection(ChatCollection)
+
+		cur, err := c.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: bson.D{{Key: "messages.sender", Value: userID}}}},
+			{{Key: "$unwind", Value: "$messages"}},
+			{{Key: "$match", Value: bson.D{{Key: "messages.sender", Value: userID}}}},
+			{{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "chat", Value: "$_id"},
+				{Key: "timestamp", Value: "$messages.timestamp"},
+				{Key: "text", Value: "$messages.text"},
+				{Key: "media", Value: "$messages.media"},
+			}}},
+			{{Key: "$sort", Value: bson.D{{Key: "timestamp", Value: 1}}}},
+		})
+		if err != nil {
+			return err
+		}
+
+		err = cur.All(ctx, &export.Messages)
+		if err != nil {
+			return err
+		}
+
+		cur, err = c.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: bson.D{{Key: "clients.id", Value: userID}}}},
+			{{Key: "$unwind", Value: "$messages"}},
+			{{Key: "$match", Value: bson.D{{Key: "messages.sender", Value: bson.D{{Key: "$exists", Value: false}}}}}},
+			{{Key: "$count", Value: "count"}},
+		})
+		if err != nil {
+			return err
+		}
+
+		counts := []struct {
+			Count int `bson:"count"`
+		}{}
+
+		err = cur.All(ctx, &counts)
+		if err != nil || len(counts) == 0 {
+			return err
+		}
+
+		export.Unattributed = counts[0].Count
+		export.Note = "сообщения, сохраненные до появления автора в данных сообщений, не включены в выгрузку, так как их автора нельзя определить"
+		return nil
+	})
+
+	return export, err
+}
+
+// Обезличивание сообщений удаляемого пользователя
+//
+// Сообщения пользователя остаются в чатах, однако ссылка на автора заменяется на NilObjectID,
+// сам пользователь исключается из участников, а чаты без участников удаляются.
+// Сообщения, сохраненные до появления поля Sender, автора не содержат и не изменяются
+func anonymizeMessages(userID primitive.ObjectID) error {
+	return utils.DB().Operation(func(ctx context.Context, w *wrap.Wrap) error {
+		c := w.Collection(ChatCollection)
+
+		_, err := c.UpdateMany(
+			ctx,
+			bson.D{{Key: "messages.sender", Value: userID}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "messages.$[m].sender", Value: primitive.NilObjectID}}}},
+			options.Update().SetArrayFilters(options.ArrayFilters{
+				Filters: []interface{}{bson.D{{Key: "m.sender", Value: userID}}},
+			}),
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.UpdateMany(
+			ctx,
+			bson.D{{Key: "clients.id", Value: userID}},
+			bson.D{{Key: "$pull", Value: bson.D{{Key: "clients", Value: bson.D{{Key: "id", Value: userID}}}}}},
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.DeleteMany(ctx, bson.D{{Key: "clients", Value: bson.D{{Key: "$size", Value: 0}}}})
+		return err
+	})
+}
@@ -42,6 +42,7 @@ func SendMessage(chatID, creatorID primitive.ObjectID, text string, media ...uti
 			bson.D{
 				{Key: "$push", Value: bson.D{
 					{Key: "messages", Value: Message{
+						Sender:    creatorID,
 						Timestamp: time.Now(),
 						Text:      text,
 						Media:     media,
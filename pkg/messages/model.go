@@ -33,7 +33,8 @@ type Client struct {
 
 // Структура описывает сообщение в чате
 type Message struct {
-	Timestamp time.Time     // Сообщение в чате
-	Text      string        // Текст сообщения
-	Media     []utils.Media // Ссылки на мультимедийный контент
+	Sender    primitive.ObjectID // Автор сообщения
+	Timestamp time.Time          // Сообщение в чате
+	Text      string             // Текст сообщения
+	Media     []utils.Media      // Ссылки на мультимедийный контент
 }
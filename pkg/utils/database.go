@@ -16,6 +16,8 @@ func DB() *wrap.Wrap {
 }
 
 // Функция настроки базы данных на основе окружения
+//
+// После подключения загружает правила доступа из базы данных
 func ConfigureDB() error {
 	wrap, err := wrap.CreateWrapFromEnv()
 	if err != nil {
@@ -23,5 +25,10 @@ func ConfigureDB() error {
 	}
 
 	db = wrap
-	return wrap.Connect()
+	err = wrap.Connect()
+	if err != nil {
+		return err
+	}
+
+	return Privileges().Load()
 }
@@ -0,0 +1,36 @@
+package utils
+
+// Доступ к внутренним функциям пакета для тестов
+var (
+	NewPrivilegesStorage = newPrivilegesStorage
+)
+
+// Удаление модуля из списка модулей без подстановки правил main
+func UnrestrictModule(module string) {
+	restrictedModulesMutex.Lock()
+	defer restrictedModulesMutex.Unlock()
+
+	delete(restrictedModules, module)
+}
+
+// Сохранение реестра прав, возвращает функцию восстановления сохраненного состояния
+func SavePermissions() func() {
+	permissions.mutex.RLock()
+	saved := make(map[string]map[string]PrivilegeType, len(permissions.modules))
+	for module, registered := range permissions.modules {
+		names := make(map[string]PrivilegeType, len(registered))
+		for name, mask := range registered {
+			names[name] = mask
+		}
+
+		saved[module] = names
+	}
+	permissions.mutex.RUnlock()
+
+	return func() {
+		permissions.mutex.Lock()
+		defer permissions.mutex.Unlock()
+
+		permissions.modules = saved
+	}
+}
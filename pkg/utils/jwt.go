@@ -60,8 +60,10 @@ func (utility *jwtUtility) ParseUnverified(tokenString string) (jwt.MapClaims, e
 }
 
 // Получение массива claims из токена
+//
+// Проверяет подпись и время действия токена (exp, nbf), истекший токен возвращает ошибку
 func (utility *jwtUtility) Parse(tokenString string) (jwt.MapClaims, error) {
-	token, err := utility.jwt.Decode(tokenString)
+	token, err := jwtauth.VerifyToken(utility.jwt, tokenString)
 	if err != nil {
 		return nil, err
 	}
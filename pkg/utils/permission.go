@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	PermissionFirstBit = 8  // Первый бит, доступный для прав модулей
+	PermissionLastBit  = 62 // Последний бит, доступный для прав модулей
+)
+
+var (
+	ErrUnknownPermission = errors.New("неизвестное право доступа")
+	ErrPermissionExists  = errors.New("право доступа уже зарегистрировано")
+	ErrUnvalidPermission = errors.New("некорректное право доступа")
+
+	// Права, доступные во всех модулях
+	basePermissions = map[string]PrivilegeType{
+		"owner_read":    OwnerRead,
+		"owner_write":   OwnerWrite,
+		"owner_update":  OwnerUpdate,
+		"owner_delete":  OwnerDelete,
+		"public_read":   PublicRead,
+		"public_write":  PublicWrite,
+		"public_update": PublicUpdate,
+		"public_delete": PublicDelete,
+	}
+
+	permissions = permissionRegistry{modules: map[string]map[string]PrivilegeType{}}
+)
+
+type permissionRegistry struct {
+	mutex   sync.RWMutex
+	modules map[string]map[string]PrivilegeType
+}
+
+// Регистрация именованного права модуля
+//
+// Право занимает бит маски с номером bit в диапазоне от PermissionFirstBit до PermissionLastBit.
+// Номер бита задается явно, так как маски хранятся в базе данных и должны совпадать
+// на всех экземплярах приложения. Биты разных модулей не пересекаются по смыслу,
+// так как правила хранятся отдельно для каждого модуля
+func RegisterPermission(module, name string, bit uint) (PrivilegeType, error) {
+	if module == "" || name == "" || bit < PermissionFirstBit || bit > PermissionLastBit {
+		return 0, ErrUnvalidPermission
+	}
+
+	if _, ok := basePermissions[name]; ok {
+		return 0, ErrPermissionExists
+	}
+
+	mask := PrivilegeType(1) << bit
+
+	permissions.mutex.Lock()
+	defer permissions.mutex.Unlock()
+
+	registered := permissions.modules[module]
+	if registered == nil {
+		registered = map[string]PrivilegeType{}
+		permissions.modules[module] = registered
+	}
+
+	for key, value := range registered {
+		if key == name && value == mask {
+			return mask, nil
+		}
+
+		if key == name || value == mask {
+			return 0, ErrPermissionExists
+		}
+	}
+
+	registered[name] = mask
+	return mask, nil
+}
+
+// Регистрация именованного права модуля при инициализации пакета
+//
+// В отличие от RegisterPermission вызывает панику при ошибке
+func MustRegisterPermission(module, name string, bit uint) PrivilegeType {
+	mask, err := RegisterPermission(module, name, bit)
+	if err != nil {
+		panic(fmt.Sprintf("право %s модуля %s: %v", name, module, err))
+	}
+
+	return mask
+}
+
+// Получение маски права по названию
+//
+// Помимо прав модуля доступны базовые права owner_read ... public_delete
+func Permission(module, name string) (PrivilegeType, error) {
+	if mask, ok := basePermissions[name]; ok {
+		return mask, nil
+	}
+
+	permissions.mutex.RLock()
+	defer permissions.mutex.RUnlock()
+
+	mask, ok := permissions.modules[module][name]
+	if !ok {
+		return 0, ErrUnknownPermission
+	}
+
+	return mask, nil
+}
+
+// Все права, доступные в модуле, включая базовые
+func Permissions(module string) map[string]PrivilegeType {
+	result := make(map[string]PrivilegeType, len(basePermissions))
+	for name, mask := range basePermissions {
+		result[name] = mask
+	}
+
+	permissions.mutex.RLock()
+	defer permissions.mutex.RUnlock()
+
+	for name, mask := range permissions.modules[module] {
+		result[name] = mask
+	}
+
+	return result
+}
+
+// Модули, зарегистрировавшие собственные права
+func PermissionModules() []string {
+	permissions.mutex.RLock()
+	defer permissions.mutex.RUnlock()
+
+	modules := make([]string, 0, len(permissions.modules))
+	for module := range permissions.modules {
+		modules = append(modules, module)
+	}
+
+	sort.Strings(modules)
+	return modules
+}
+
+// Названия прав, установленных в маске
+//
+// Второе значение содержит биты маски, для которых в модуле нет зарегистрированных названий
+func PermissionNames(module string, mask PrivilegeType) ([]string, PrivilegeType) {
+	names := []string{}
+
+	for name, value := range Permissions(module) {
+		if mask.Check(value) {
+			names = append(names, name)
+			mask.Unset(value)
+		}
+	}
+
+	sort.Strings(names)
+	return names, mask
+}
+
+// Приведение списка прав к маскам
+//
+// Элементы списка могут быть масками PrivilegeType или названиями прав модуля
+func ResolvePermissions(module string, items ...interface{}) ([]PrivilegeType, error) {
+	result := make([]PrivilegeType, 0, len(items))
+
+	for _, item := range items {
+		switch value := item.(type) {
+		case PrivilegeType:
+			result = append(result, value)
+		case string:
+			mask, err := Permission(module, value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", err, value)
+			}
+
+			result = append(result, mask)
+		default:
+			return nil, ErrUnvalidPermission
+		}
+	}
+
+	return result, nil
+}
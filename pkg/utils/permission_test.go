@@ -0,0 +1,44 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_RegisterPermission(t *testing.T) {
+	t.Cleanup(utils.SavePermissions())
+
+	storage := utils.NewPrivilegesStorage()
+	publish := utils.MustRegisterPermission("blog", "publish", 8)
+
+	_, err := utils.RegisterPermission("blog", "pin", 8)
+	if err != utils.ErrPermissionExists {
+		t.Errorf("ожидалась ошибка %v, получено %v", utils.ErrPermissionExists, err)
+	}
+
+	err = storage.SetGroup("moderator", "blog", publish, utils.PublicRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privileges, err := utils.ResolvePermissions("blog", "publish", utils.PublicRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !storage.Check(primitive.NewObjectID(), "moderator", "blog", privileges...) {
+		t.Error("право publish не найдено")
+	}
+
+	names, unknown := utils.PermissionNames("blog", publish|utils.OwnerRead|1<<20)
+	if len(names) != 2 || names[0] != "owner_read" || names[1] != "publish" || unknown != 1<<20 {
+		t.Errorf("неверные названия прав: %v, %d", names, unknown)
+	}
+
+	_, err = utils.ResolvePermissions("blog", "export")
+	if err == nil {
+		t.Error("незарегистрированное право разрешено")
+	}
+}
@@ -0,0 +1,445 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Операторы условий политик
+const (
+	OperatorEqual        = "eq"       // атрибут равен значению
+	OperatorNotEqual     = "ne"       // атрибут не равен значению
+	OperatorIn           = "in"       // атрибут входит в список
+	OperatorNotIn        = "nin"      // атрибут не входит в список
+	OperatorContains     = "contains" // список в атрибуте содержит значение
+	OperatorGreater      = "gt"       // атрибут больше значения
+	OperatorGreaterEqual = "gte"      // атрибут больше или равен значению
+	OperatorLess         = "lt"       // атрибут меньше значения
+	OperatorLessEqual    = "lte"      // атрибут меньше или равен значению
+	OperatorCIDR         = "cidr"     // IP адрес в атрибуте входит в одну из подсетей
+	OperatorExists       = "exists"   // атрибут задан (значение true) или не задан (false)
+)
+
+var (
+	ErrUnvalidPolicy = errors.New("некорректная политика доступа")
+	ErrPolicyDenied  = errors.New("запрос отклонен политикой доступа")
+
+	policyOperators = map[string]bool{
+		OperatorEqual: true, OperatorNotEqual: true, OperatorIn: true, OperatorNotIn: true,
+		OperatorContains: true, OperatorGreater: true, OperatorGreaterEqual: true,
+		OperatorLess: true, OperatorLessEqual: true, OperatorCIDR: true, OperatorExists: true,
+	}
+
+	policyRoots = map[string]bool{"principal": true, "resource": true, "env": true}
+
+	policiesDocumentType = "privilege_policies"
+)
+
+// Политика доступа модуля
+//
+// Политика ограничивает права, уже разрешенные масками: если политика применима к запросу,
+// все ее условия должны выполняться, иначе запрос отклоняется.
+// Политика применима, если группа пользователя указана в Groups (пустой список - любая группа)
+// и запрошено хотя бы одно право из Privileges (ноль - любое право)
+type Policy struct {
+	Name       string        `json:"name" bson:"name"`
+	Groups     []string      `json:"groups,omitempty" bson:"groups,omitempty"`
+	Privileges PrivilegeType `json:"privileges,omitempty" bson:"privileges,omitempty"`
+	Conditions []Condition   `json:"conditions" bson:"conditions"`
+}
+
+// Условие политики доступа
+//
+// Attribute и Ref задаются путем вида "principal.group", "resource.section" или "env.ip".
+// Если задан Ref, атрибут сравнивается со значением другого атрибута, иначе с Value.
+// Например, условие {resource.section in principal.sections} разрешает модератору
+// действия только в назначенных ему разделах
+type Condition struct {
+	Attribute string      `json:"attribute" bson:"attribute"`
+	Operator  string      `json:"operator" bson:"operator"`
+	Value     interface{} `json:"value,omitempty" bson:"value,omitempty"`
+	Ref       string      `json:"ref,omitempty" bson:"ref,omitempty"`
+}
+
+// Атрибуты запроса для проверки политик
+//
+// Principal содержит атрибуты пользователя (id, group и дополнительные),
+// Resource - атрибуты ресурса (например owner), Environment - атрибуты окружения
+// (ip, time, hour, weekday и другие)
+type PolicyRequest struct {
+	Principal   map[string]interface{}
+	Resource    map[string]interface{}
+	Environment map[string]interface{}
+}
+
+type policiesDocument struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Type     string             `bson:"type"`
+	Module   string             `bson:"module"`
+	Policies []Policy           `bson:"policies"`
+}
+
+// Установка политик модуля
+//
+// Заменяет все политики модуля, пустой список отключает политики.
+// Политики хранятся в системной коллекции отдельным документом для каждого модуля
+func (ps *PrivilegesStorage) SetPolicies(module string, policies []Policy) error {
+	for _, policy := range policies {
+		err := policy.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	policies = append([]Policy{}, policies...)
+
+	if ps.current().loaded {
+		err := ps.savePolicies(module, policies)
+		if err != nil {
+			return err
+		}
+	}
+
+	// изменение версии правил сообщает другим экземплярам о необходимости загрузки политик
+	return ps.commit(func(next *privilegesSnapshot) error {
+		if len(policies) == 0 {
+			delete(next.policies, module)
+		} else {
+			next.policies[module] = policies
+		}
+
+		return nil
+	})
+}
+
+// Политики модуля
+func (ps *PrivilegesStorage) Policies(module string) []Policy {
+	return append([]Policy{}, ps.current().policies[module]...)
+}
+
+// Проверка прав пользователя с учетом политик модуля
+//
+// Сначала проверяются маски (см. Check), затем политики модуля
+func (ps *PrivilegesStorage) Authorize(id primitive.ObjectID, group, module string, request PolicyRequest, privileges ...PrivilegeType) bool {
+	if !ps.Check(id, group, module, privileges...) {
+		return false
+	}
+
+	return ps.CheckPolicies(group, module, request, privileges...) == nil
+}
+
+// Проверка политик модуля
+//
+// Возвращает ошибку ErrPolicyDenied с названием первой политики, условия которой не выполнены
+func (ps *PrivilegesStorage) CheckPolicies(group, module string, request PolicyRequest, privileges ...PrivilegeType) error {
+	var requested PrivilegeType
+	for _, item := range privileges {
+		requested |= item
+	}
+
+	for _, policy := range ps.current().policies[module] {
+		if !policy.applies(group, requested) {
+			continue
+		}
+
+		for _, condition := range policy.Conditions {
+			if !condition.Evaluate(request) {
+				return fmt.Errorf("%w: %s", ErrPolicyDenied, policy.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Проверка корректности политики
+func (p Policy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("%w: не задано название", ErrUnvalidPolicy)
+	}
+
+	for _, condition := range p.Conditions {
+		if !policyOperators[condition.Operator] {
+			return fmt.Errorf("%w: неизвестный оператор %s", ErrUnvalidPolicy, condition.Operator)
+		}
+
+		for _, path := range []string{condition.Attribute, condition.Ref} {
+			if path != "" && !policyRoots[strings.SplitN(path, ".", 2)[0]] {
+				return fmt.Errorf("%w: неизвестный атрибут %s", ErrUnvalidPolicy, path)
+			}
+		}
+
+		if condition.Attribute == "" {
+			return fmt.Errorf("%w: не задан атрибут", ErrUnvalidPolicy)
+		}
+
+		if condition.Operator == OperatorCIDR {
+			for _, item := range policyList(condition.Value) {
+				network, _ := item.(string)
+				if _, _, err := net.ParseCIDR(network); err != nil {
+					return fmt.Errorf("%w: некорректная подсеть %v", ErrUnvalidPolicy, item)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p Policy) applies(group string, requested PrivilegeType) bool {
+	if p.Privileges != 0 && p.Privileges&requested == 0 {
+		return false
+	}
+
+	if len(p.Groups) == 0 {
+		return true
+	}
+
+	for _, item := range p.Groups {
+		if item == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Проверка условия для запроса
+func (c Condition) Evaluate(request PolicyRequest) bool {
+	value, exists := request.lookup(c.Attribute)
+
+	expected := c.Value
+	if c.Ref != "" {
+		expected, _ = request.lookup(c.Ref)
+	}
+
+	switch c.Operator {
+	case OperatorExists:
+		want, _ := expected.(bool)
+		return exists == want
+	case OperatorEqual:
+		return exists && policyEqual(value, expected)
+	case OperatorNotEqual:
+		return !exists || !policyEqual(value, expected)
+	case OperatorIn:
+		return exists && policyContains(expected, value)
+	case OperatorNotIn:
+		return !exists || !policyContains(expected, value)
+	case OperatorContains:
+		return exists && policyContains(value, expected)
+	case OperatorGreater, OperatorGreaterEqual, OperatorLess, OperatorLessEqual:
+		result, ok := policyCompare(value, expected)
+		if !exists || !ok {
+			return false
+		}
+
+		switch c.Operator {
+		case OperatorGreater:
+			return result > 0
+		case OperatorGreaterEqual:
+			return result >= 0
+		case OperatorLess:
+			return result < 0
+		default:
+			return result <= 0
+		}
+	case OperatorCIDR:
+		address, _ := value.(string)
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return false
+		}
+
+		for _, item := range policyList(expected) {
+			network, _ := item.(string)
+			_, subnet, err := net.ParseCIDR(network)
+			if err == nil && subnet.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	default:
+		return false
+	}
+}
+
+// Получение атрибута запроса по пути
+func (r PolicyRequest) lookup(path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+
+	var value interface{}
+	switch parts[0] {
+	case "principal":
+		value = r.Principal
+	case "resource":
+		value = r.Resource
+	case "env":
+		value = r.Environment
+	default:
+		return nil, false
+	}
+
+	for _, key := range parts[1:] {
+		var ok bool
+		switch document := value.(type) {
+		case map[string]interface{}:
+			value, ok = document[key]
+		case primitive.M:
+			value, ok = document[key]
+		case primitive.D:
+			value, ok = document.Map()[key]
+		}
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return value, value != nil
+}
+
+// Приведение значения к виду, пригодному для сравнения
+func policyNormalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time()
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, PrivilegeType:
+		return reflect.ValueOf(v).Convert(reflect.TypeOf(float64(0))).Float()
+	default:
+		return value
+	}
+}
+
+func policyEqual(a, b interface{}) bool {
+	result, ok := policyCompare(a, b)
+	if ok {
+		return result == 0
+	}
+
+	return reflect.DeepEqual(policyNormalize(a), policyNormalize(b))
+}
+
+func policyCompare(a, b interface{}) (int, bool) {
+	switch x := policyNormalize(a).(type) {
+	case float64:
+		y, ok := policyNormalize(b).(float64)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+
+		return 0, true
+	case string:
+		y, ok := policyNormalize(b).(string)
+		if !ok {
+			return 0, false
+		}
+
+		return strings.Compare(x, y), true
+	case time.Time:
+		y, ok := policyNormalize(b).(time.Time)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func policyContains(list, value interface{}) bool {
+	for _, item := range policyList(list) {
+		if policyEqual(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Приведение значения к списку, одиночное значение считается списком из одного элемента
+func policyList(value interface{}) []interface{} {
+	if value == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []interface{}{value}
+	}
+
+	items := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		items = append(items, v.Index(i).Interface())
+	}
+
+	return items
+}
+
+func (ps *PrivilegesStorage) savePolicies(module string, policies []Policy) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+	defer cancel()
+
+	id, _ := db.PredictableObjectID("privileges.policies." + module)
+
+	_, err := DB().Collection(systemCollection).ReplaceOne(ctx, bson.D{{Key: "_id", Value: id}}, policiesDocument{
+		ID:       id,
+		Type:     policiesDocumentType,
+		Module:   module,
+		Policies: policies,
+	}, options.Replace().SetUpsert(true))
+
+	return err
+}
+
+func (ps *PrivilegesStorage) fetchPolicies() (map[string][]Policy, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+	defer cancel()
+
+	docs := []policiesDocument{}
+
+	cur, err := DB().Collection(systemCollection).Find(ctx, bson.D{{Key: "type", Value: policiesDocumentType}})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cur.All(ctx, &docs)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string][]Policy, len(docs))
+	for _, doc := range docs {
+		if len(doc.Policies) != 0 {
+			policies[doc.Module] = doc.Policies
+		}
+	}
+
+	return policies, nil
+}
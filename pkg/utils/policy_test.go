@@ -0,0 +1,71 @@
+package utils_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+)
+
+func Test_PolicyConditions(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+
+	err := storage.SetPolicies("forum", []utils.Policy{
+		{
+			Name:       "sections",
+			Groups:     []string{"moderator"},
+			Privileges: utils.PublicUpdate,
+			Conditions: []utils.Condition{
+				{Attribute: "resource.section", Operator: utils.OperatorIn, Ref: "principal.forum.sections"},
+			},
+		},
+		{
+			Name:       "office",
+			Privileges: utils.OwnerWrite | utils.PublicWrite,
+			Conditions: []utils.Condition{
+				{Attribute: "env.hour", Operator: utils.OperatorGreaterEqual, Value: 9},
+				{Attribute: "env.hour", Operator: utils.OperatorLess, Value: 18},
+				{Attribute: "env.ip", Operator: utils.OperatorCIDR, Value: []string{"10.0.0.0/8"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	principal := map[string]interface{}{
+		"forum": map[string]interface{}{"sections": []interface{}{"news", "help"}},
+	}
+
+	cases := []struct {
+		name       string
+		group      string
+		request    utils.PolicyRequest
+		privileges utils.PrivilegeType
+		allowed    bool
+	}{
+		{"назначенный раздел", "moderator", utils.PolicyRequest{Principal: principal, Resource: map[string]interface{}{"section": "news"}}, utils.PublicUpdate, true},
+		{"чужой раздел", "moderator", utils.PolicyRequest{Principal: principal, Resource: map[string]interface{}{"section": "games"}}, utils.PublicUpdate, false},
+		{"политика другой группы", "admin", utils.PolicyRequest{Resource: map[string]interface{}{"section": "games"}}, utils.PublicUpdate, true},
+		{"рабочее время в офисе", "user", utils.PolicyRequest{Environment: map[string]interface{}{"hour": 10, "ip": "10.1.2.3"}}, utils.OwnerWrite, true},
+		{"нерабочее время", "user", utils.PolicyRequest{Environment: map[string]interface{}{"hour": 20, "ip": "10.1.2.3"}}, utils.OwnerWrite, false},
+		{"внешняя сеть", "user", utils.PolicyRequest{Environment: map[string]interface{}{"hour": 10, "ip": "8.8.8.8"}}, utils.OwnerWrite, false},
+		{"чтение без условий", "user", utils.PolicyRequest{}, utils.OwnerRead, true},
+	}
+
+	for _, item := range cases {
+		err := storage.CheckPolicies(item.group, "forum", item.request, item.privileges)
+		if (err == nil) != item.allowed {
+			t.Errorf("%s: получено %v", item.name, err)
+		}
+
+		if err != nil && !errors.Is(err, utils.ErrPolicyDenied) {
+			t.Errorf("%s: неожиданная ошибка %v", item.name, err)
+		}
+	}
+
+	err = storage.SetPolicies("forum", []utils.Policy{{Name: "broken", Conditions: []utils.Condition{{Attribute: "user.id", Operator: utils.OperatorEqual}}}})
+	if !errors.Is(err, utils.ErrUnvalidPolicy) {
+		t.Errorf("ожидалась ошибка %v, получено %v", utils.ErrUnvalidPolicy, err)
+	}
+}
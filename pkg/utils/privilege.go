@@ -1,36 +1,36 @@
 package utils
 
 import (
-	"context"
 	"errors"
 	"fmt"
-	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-type PrivilegeType int
+// Маска прав доступа
+//
+// Младшие 8 бит заняты базовыми правами, остальные биты модули
+// используют для собственных прав (см. RegisterPermission)
+type PrivilegeType int64
 
+// Установка всех прав маски privilege
 func (pt *PrivilegeType) Set(privilege PrivilegeType) {
-	if pt.Check(privilege) {
-		return
-	}
-
-	*pt += privilege
+	*pt |= privilege
 }
 
+// Снятие всех прав маски privilege
 func (pt *PrivilegeType) Unset(privilege PrivilegeType) {
-	if !pt.Check(privilege) {
-		return
-	}
-
-	*pt -= privilege
+	*pt &^= privilege
 }
 
+// Проверка, что установлены все права маски privilege
 func (pt *PrivilegeType) Check(privilege PrivilegeType) bool {
-	return int(*pt)&int(privilege) == 1
+	return *pt&privilege == privilege
 }
 
 const (
@@ -55,65 +55,112 @@ func Privileges() *PrivilegesStorage {
 
 func newPrivilegesStorage() *PrivilegesStorage {
 	objID, _ := db.PredictableObjectID("privileges")
-	storage := &PrivilegesStorage{ID: objID, Rules: map[string]PrivilegeType{}}
+	storage := &PrivilegesStorage{ID: objID}
+	storage.snapshot.Store(defaultPrivileges())
+	return storage
+}
+
+// Правила, которые записываются в базу данных, если в ней еще нет правил
+func defaultPrivileges() *privilegesSnapshot {
+	storage := &PrivilegesStorage{}
+	storage.snapshot.Store(&privilegesSnapshot{
+		rules:   map[string]PrivilegeType{},
+		parents: map[string][]string{},
+	})
 
 	storage.SetGroup("guest", "main", PublicRead)
 	storage.SetGroup("banned", "main", PublicRead, OwnerRead)
 	storage.SetGroup("user", "main", OwnerRead, OwnerWrite, OwnerUpdate, OwnerDelete, PublicRead)
-	storage.SetGroup("moderator", "main", OwnerRead, OwnerWrite, OwnerUpdate, OwnerDelete, PublicRead, PublicUpdate)
-	storage.SetGroup("admin", "main", OwnerRead, OwnerWrite, OwnerUpdate, OwnerDelete, PublicRead, PublicWrite, PublicUpdate, OwnerDelete)
+	storage.SetGroup("moderator", "main", PublicUpdate)
+	storage.SetGroup("admin", "main", PublicWrite)
 
-	return storage
-}
+	storage.SetParents("moderator", "user")
+	storage.SetParents("admin", "moderator")
 
-type PrivilegesStorage struct {
-	ID        primitive.ObjectID       `bson:"_id"`
-	Rules     map[string]PrivilegeType `bson:"rules"`
-	Timestamp time.Time                `bson:"time"`
+	storage.ensureRestricted()
 
-	shared bool
+	return storage.current()
 }
 
-func (ps *PrivilegesStorage) Sync() {
-	ps.shared = true
+// Хранилище правил доступа
+//
+// Правила хранятся по ключу "группа.модуль" или "идентификатор пользователя.модуль".
+// Группы могут наследовать правила родительских групп (см. SetParents).
+// После вызова Load хранилище связано с документом в системной коллекции:
+// изменения сохраняются в базу с проверкой версии документа,
+// а Sync включает получение изменений, сделанных другими экземплярами приложения.
+//
+// Хранилище безопасно для конкурентного использования: проверки читают неизменяемый снимок правил
+// без блокировок, а изменения применяются к копии и публикуют новый снимок
+type PrivilegesStorage struct {
+	ID primitive.ObjectID
 
-	go ps.autoupdate()
+	snapshot atomic.Value // *privilegesSnapshot
+	mutex    sync.Mutex   // упорядочивает изменения и загрузку правил
+	stop     chan struct{}
 }
 
-func (ps *PrivilegesStorage) Unsync() {
-	ps.shared = false
+// Неизменяемый снимок правил доступа
+type privilegesSnapshot struct {
+	rules     map[string]PrivilegeType
+	parents   map[string][]string
+	policies  map[string][]Policy
+	grants    []Grant
+	version   int64
+	timestamp time.Time
+	loaded    bool
 }
 
-func (ps *PrivilegesStorage) autoupdate() {
-	for ps.shared {
-		ctx, cancel := context.WithTimeout(context.TODO(), time.Second*10)
+// Копия снимка для внесения изменений
+func (s *privilegesSnapshot) clone() *privilegesSnapshot {
+	next := &privilegesSnapshot{
+		rules:    make(map[string]PrivilegeType, len(s.rules)),
+		parents:  make(map[string][]string, len(s.parents)),
+		policies: make(map[string][]Policy, len(s.policies)),
+		grants:   append([]Grant{}, s.grants...),
+		version:  s.version,
+		loaded:   s.loaded,
+	}
 
-		c, _ := DB().Collection(systemCollection).CountDocuments(ctx, bson.D{
-			{Key: "_id", Value: ps.ID},
-			{Key: "time", Value: ps.Timestamp},
-		})
+	for key, value := range s.rules {
+		next.rules[key] = value
+	}
 
-		if c > 0 {
-			cancel()
-		} else {
-			ps.Timestamp = time.Now()
+	for group, parents := range s.parents {
+		next.parents[group] = append([]string{}, parents...)
+	}
 
-			_, err := DB().Collection(systemCollection).UpdateByID(ctx, ps.ID, bson.D{
-				{Key: "rules", Value: ps.Rules},
-				{Key: "time", Value: ps.Timestamp},
-			})
+	// политики не изменяются после установки, поэтому копируется только список
+	for module, policies := range s.policies {
+		next.policies[module] = policies
+	}
 
-			if err != nil {
-				log.Println(err)
-			}
+	return next
+}
 
-			cancel()
-		}
+func (ps *PrivilegesStorage) current() *privilegesSnapshot {
+	return ps.snapshot.Load().(*privilegesSnapshot)
+}
+
+// Копия текущих правил доступа
+func (ps *PrivilegesStorage) Rules() map[string]PrivilegeType {
+	rules := ps.current().rules
+
+	result := make(map[string]PrivilegeType, len(rules))
+	for key, value := range rules {
+		result[key] = value
 	}
+
+	return result
 }
 
-func (ps *PrivilegesStorage) SetGroup(name, module string, privileges ...PrivilegeType) {
-	ps.updatemask(ps.generateKey(name, module), func(pt PrivilegeType) PrivilegeType {
+// Версия документа правил доступа в базе данных
+func (ps *PrivilegesStorage) Version() int64 {
+	return ps.current().version
+}
+
+func (ps *PrivilegesStorage) SetGroup(name, module string, privileges ...PrivilegeType) error {
+	return ps.updatemask(ps.generateKey(name, module), func(pt PrivilegeType) PrivilegeType {
 		for _, item := range privileges {
 			pt.Set(item)
 		}
@@ -122,8 +169,8 @@ func (ps *PrivilegesStorage) SetGroup(name, module string, privileges ...Privile
 	})
 }
 
-func (ps *PrivilegesStorage) UnsetGroup(name, module string, privileges ...PrivilegeType) {
-	ps.updatemask(ps.generateKey(name, module), func(pt PrivilegeType) PrivilegeType {
+func (ps *PrivilegesStorage) UnsetGroup(name, module string, privileges ...PrivilegeType) error {
+	return ps.updatemask(ps.generateKey(name, module), func(pt PrivilegeType) PrivilegeType {
 		for _, item := range privileges {
 			pt.Unset(item)
 		}
@@ -132,8 +179,8 @@ func (ps *PrivilegesStorage) UnsetGroup(name, module string, privileges ...Privi
 	})
 }
 
-func (ps *PrivilegesStorage) SetUser(id primitive.ObjectID, module string, privileges ...PrivilegeType) {
-	ps.updatemask(ps.generateKey(id.Hex(), module), func(pt PrivilegeType) PrivilegeType {
+func (ps *PrivilegesStorage) SetUser(id primitive.ObjectID, module string, privileges ...PrivilegeType) error {
+	return ps.updatemask(ps.generateKey(id.Hex(), module), func(pt PrivilegeType) PrivilegeType {
 		for _, item := range privileges {
 			pt.Set(item)
 		}
@@ -142,8 +189,8 @@ func (ps *PrivilegesStorage) SetUser(id primitive.ObjectID, module string, privi
 	})
 }
 
-func (ps *PrivilegesStorage) UnsetUser(id primitive.ObjectID, module string, privileges ...PrivilegeType) {
-	ps.updatemask(ps.generateKey(id.Hex(), module), func(pt PrivilegeType) PrivilegeType {
+func (ps *PrivilegesStorage) UnsetUser(id primitive.ObjectID, module string, privileges ...PrivilegeType) error {
+	return ps.updatemask(ps.generateKey(id.Hex(), module), func(pt PrivilegeType) PrivilegeType {
 		for _, item := range privileges {
 			pt.Unset(item)
 		}
@@ -152,23 +199,236 @@ func (ps *PrivilegesStorage) UnsetUser(id primitive.ObjectID, module string, pri
 	})
 }
 
+// Добавление прав к персональному правилу пользователя
+//
+// Если персонального правила модуля нет, оно создается с правами, которые пользователь группы group
+// получает по остальным правилам, поэтому выдача права не отнимает у пользователя уже имеющиеся права
+func (ps *PrivilegesStorage) ExtendUser(id primitive.ObjectID, group, module string, privileges ...PrivilegeType) error {
+	key := ps.generateKey(id.Hex(), module)
+
+	return ps.commit(func(next *privilegesSnapshot) error {
+		mask, ok := next.rules[key]
+		if !ok {
+			mask = ps.inheritedmask(next, id, group, module)
+		}
+
+		for _, item := range privileges {
+			mask.Set(item)
+		}
+
+		next.rules[key] = mask
+		return nil
+	})
+}
+
+// Снятие прав с персонального правила пользователя
+//
+// Отсутствующее правило не создается. Правило, в котором не осталось прав, удаляется,
+// после чего для пользователя снова действуют правила его группы
+func (ps *PrivilegesStorage) ReduceUser(id primitive.ObjectID, module string, privileges ...PrivilegeType) error {
+	key := ps.generateKey(id.Hex(), module)
+
+	err := ps.commit(func(next *privilegesSnapshot) error {
+		mask, ok := next.rules[key]
+		if !ok {
+			return errNoChanges
+		}
+
+		for _, item := range privileges {
+			mask.Unset(item)
+		}
+
+		if mask == 0 {
+			delete(next.rules, key)
+		} else {
+			next.rules[key] = mask
+		}
+
+		return nil
+	})
+	if err == errNoChanges {
+		return nil
+	}
+
+	return err
+}
+
+// Удаление всех персональных правил пользователя
+//
+// Если у пользователя нет персональных правил и временных прав, правила не сохраняются
+func (ps *PrivilegesStorage) RemoveUser(id primitive.ObjectID) error {
+	prefix := id.Hex() + "."
+
+	err := ps.commit(func(next *privilegesSnapshot) error {
+		removed := false
+		for key := range next.rules {
+			if strings.HasPrefix(key, prefix) {
+				delete(next.rules, key)
+				removed = true
+			}
+		}
+
+		grants := filterGrants(next.grants, func(grant Grant) bool { return grant.User != id })
+		if !removed && len(grants) == len(next.grants) {
+			return errNoChanges
+		}
+
+		next.grants = grants
+		return nil
+	})
+	if err == errNoChanges {
+		return nil
+	}
+
+	return err
+}
+
+// Список групп, для которых установлены правила
+func (ps *PrivilegesStorage) Groups() []string {
+	snapshot := ps.current()
+	groups := []string{}
+	known := map[string]bool{}
+
+	add := func(name string) {
+		if known[name] || primitive.IsValidObjectID(name) {
+			return
+		}
+
+		known[name] = true
+		groups = append(groups, name)
+	}
+
+	for key := range snapshot.rules {
+		add(strings.SplitN(key, ".", 2)[0])
+	}
+
+	for group, parents := range snapshot.parents {
+		add(group)
+		for _, parent := range parents {
+			add(parent)
+		}
+	}
+
+	sort.Strings(groups)
+	return groups
+}
+
+// Правила группы по модулям без учета наследования
+func (ps *PrivilegesStorage) GroupRules(name string) map[string]PrivilegeType {
+	return ps.subjectRules(name)
+}
+
+// Персональные правила пользователя по модулям
+func (ps *PrivilegesStorage) UserRules(id primitive.ObjectID) map[string]PrivilegeType {
+	return ps.subjectRules(id.Hex())
+}
+
+// Пользователи, для которых установлены персональные правила
+func (ps *PrivilegesStorage) Users() []primitive.ObjectID {
+	users := []primitive.ObjectID{}
+	known := map[string]bool{}
+
+	for key := range ps.current().rules {
+		subject := strings.SplitN(key, ".", 2)[0]
+		if known[subject] {
+			continue
+		}
+
+		id, err := primitive.ObjectIDFromHex(subject)
+		if err != nil {
+			continue
+		}
+
+		known[subject] = true
+		users = append(users, id)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Hex() < users[j].Hex() })
+	return users
+}
+
+// Модули, для которых установлены правила
+func (ps *PrivilegesStorage) Modules() []string {
+	modules := []string{}
+	known := map[string]bool{}
+
+	for key := range ps.current().rules {
+		parts := strings.SplitN(key, ".", 2)
+		if len(parts) != 2 || known[parts[1]] {
+			continue
+		}
+
+		known[parts[1]] = true
+		modules = append(modules, parts[1])
+	}
+
+	sort.Strings(modules)
+	return modules
+}
+
+func (ps *PrivilegesStorage) subjectRules(subject string) map[string]PrivilegeType {
+	prefix := subject + "."
+	result := map[string]PrivilegeType{}
+
+	for key, value := range ps.current().rules {
+		if strings.HasPrefix(key, prefix) {
+			result[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+
+	return result
+}
+
+// Проверка наличия правил для группы
+func (ps *PrivilegesStorage) HasGroup(name string) bool {
+	for _, group := range ps.Groups() {
+		if group == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Проверка прав пользователя
+//
+// Правила проверяются в порядке: пользователь и модуль, пользователь и main, группа и модуль
+// (правила main пропускаются для модулей из RestrictModule). Маска группы объединяет правила группы
+// и всех родительских групп: каждая группа добавляет свое правило модуля, а если его нет - свое правило main.
+// Действующие временные права пользователя (см. GrantUser) дополняют права, определенные правилами
 func (ps *PrivilegesStorage) Check(id primitive.ObjectID, group, module string, privileges ...PrivilegeType) bool {
-	val, err := ps.check(id.Hex(), module, privileges...)
-	if err == nil {
-		return val
+	snapshot := ps.current()
+
+	if granted := snapshot.grantmask(id, module, time.Now()); granted != 0 {
+		rest := make([]PrivilegeType, 0, len(privileges))
+		for _, item := range privileges {
+			if item&^granted != 0 {
+				rest = append(rest, item&^granted)
+			}
+		}
+
+		if len(rest) == 0 {
+			return true
+		}
+
+		privileges = rest
 	}
 
-	val, err = ps.check(id.Hex(), "main", privileges...)
+	val, err := ps.check(snapshot.rules, id.Hex(), module, privileges...)
 	if err == nil {
 		return val
 	}
 
-	val, err = ps.check(group, module, privileges...)
-	if err == nil {
-		return val
+	restricted := IsRestrictedModule(module)
+
+	if !restricted {
+		val, err = ps.check(snapshot.rules, id.Hex(), "main", privileges...)
+		if err == nil {
+			return val
+		}
 	}
 
-	val, err = ps.check(group, "main", privileges...)
+	val, err = ps.checkGroup(snapshot, group, module, privileges...)
 	if err == nil {
 		return val
 	}
@@ -176,23 +436,47 @@ func (ps *PrivilegesStorage) Check(id primitive.ObjectID, group, module string,
 	return false
 }
 
-func (ps *PrivilegesStorage) check(first, second string, privileges ...PrivilegeType) (bool, error) {
-	value, err := ps.getmask(ps.generateKey(first, second))
+// Маска, которую пользователь получает без персонального правила модуля
+func (ps *PrivilegesStorage) inheritedmask(snapshot *privilegesSnapshot, id primitive.ObjectID, group, module string) PrivilegeType {
+	for _, step := range ps.explainChain(snapshot, id, group, module)[1:] {
+		if step.Found {
+			return step.Mask
+		}
+	}
+
+	return 0
+}
+
+func (ps *PrivilegesStorage) check(rules map[string]PrivilegeType, first, second string, privileges ...PrivilegeType) (bool, error) {
+	value, err := ps.getmask(rules, ps.generateKey(first, second))
 	if err != nil {
 		return false, err
 	}
 
+	return checkMask(value, privileges...), nil
+}
+
+func (ps *PrivilegesStorage) checkGroup(snapshot *privilegesSnapshot, group, module string, privileges ...PrivilegeType) (bool, error) {
+	value, found := ps.effectivemask(snapshot, group, module)
+	if !found {
+		return false, errors.New("value not found")
+	}
+
+	return checkMask(value, privileges...), nil
+}
+
+func checkMask(value PrivilegeType, privileges ...PrivilegeType) bool {
 	for _, item := range privileges {
 		if !value.Check(item) {
-			return false, nil
+			return false
 		}
 	}
 
-	return true, nil
+	return true
 }
 
-func (ps *PrivilegesStorage) getmask(key string) (PrivilegeType, error) {
-	val, b := ps.Rules[key]
+func (ps *PrivilegesStorage) getmask(rules map[string]PrivilegeType, key string) (PrivilegeType, error) {
+	val, b := rules[key]
 	if !b {
 		return val, errors.New("value not found")
 	}
@@ -200,34 +484,13 @@ func (ps *PrivilegesStorage) getmask(key string) (PrivilegeType, error) {
 	return val, nil
 }
 
-func (ps *PrivilegesStorage) setmask(key string, value PrivilegeType) {
-	ps.Rules[key] = value
-	ps.save()
-}
-
-func (ps *PrivilegesStorage) updatemask(key string, update func(PrivilegeType) PrivilegeType) {
-	mask, _ := ps.getmask(key)
-	mask = update(mask)
-	ps.setmask(key, mask)
+func (ps *PrivilegesStorage) updatemask(key string, update func(PrivilegeType) PrivilegeType) error {
+	return ps.commit(func(next *privilegesSnapshot) error {
+		next.rules[key] = update(next.rules[key])
+		return nil
+	})
 }
 
 func (ps *PrivilegesStorage) generateKey(first, second string) string {
 	return fmt.Sprintf("%s.%s", first, second)
 }
-
-func (ps *PrivilegesStorage) save() error {
-	if !ps.shared {
-		return nil
-	}
-
-	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
-	defer cancel()
-
-	_, err := DB().Collection(systemCollection).UpdateByID(ctx, ps.ID, bson.D{
-		{Key: "$set", Value: bson.D{
-			{Key: "rules", Value: ps.Rules},
-		}},
-	})
-
-	return err
-}
@@ -0,0 +1,335 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Режим импорта правил доступа
+type ImportMode string
+
+const (
+	ImportReplace ImportMode = "replace" // Правила и наследование групп полностью заменяются конфигурацией (кроме правил по умолчанию модулей из RestrictModule)
+	ImportMerge   ImportMode = "merge"   // Правила из конфигурации заменяют существующие, остальные сохраняются
+
+	unnamedPermissionPrefix = "bit_"
+)
+
+var (
+	ErrUnvalidImportMode = errors.New("неизвестный режим импорта правил доступа")
+
+	// Прерывает сохранение, если импорт не изменяет правила
+	errNoChanges = errors.New("правила доступа не изменены")
+)
+
+// Конфигурация правил доступа в читаемом виде
+//
+// Права записываются названиями (см. RegisterPermission), биты без названий - в виде bit_N.
+// Временные права и политики в конфигурацию не входят
+type PrivilegesConfig struct {
+	Groups map[string]GroupConfig `json:"groups"`
+	Users  map[string]UserConfig  `json:"users,omitempty"`
+}
+
+// Правила группы в конфигурации
+type GroupConfig struct {
+	Parents []string            `json:"parents,omitempty"`
+	Rules   map[string][]string `json:"rules,omitempty"`
+}
+
+// Персональные правила пользователя в конфигурации
+type UserConfig struct {
+	Rules map[string][]string `json:"rules"`
+}
+
+// Изменение правила при импорте
+type RuleChange struct {
+	Key    string   `json:"key"`              // Ключ правила или group.parents для наследования
+	Action string   `json:"action"`           // add, change или remove
+	Before []string `json:"before,omitempty"` // Права до импорта
+	After  []string `json:"after,omitempty"`  // Права после импорта
+}
+
+// Выгрузка правил доступа
+func (ps *PrivilegesStorage) ExportConfig() PrivilegesConfig {
+	snapshot := ps.current()
+	config := PrivilegesConfig{Groups: map[string]GroupConfig{}, Users: map[string]UserConfig{}}
+
+	for key, mask := range snapshot.rules {
+		parts := strings.SplitN(key, ".", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		subject, module := parts[0], parts[1]
+		names := permissionConfigNames(module, mask)
+
+		if primitive.IsValidObjectID(subject) {
+			user := config.Users[subject]
+			if user.Rules == nil {
+				user.Rules = map[string][]string{}
+			}
+
+			user.Rules[module] = names
+			config.Users[subject] = user
+			continue
+		}
+
+		group := config.Groups[subject]
+		if group.Rules == nil {
+			group.Rules = map[string][]string{}
+		}
+
+		group.Rules[module] = names
+		config.Groups[subject] = group
+	}
+
+	for name, parents := range snapshot.parents {
+		group := config.Groups[name]
+		group.Parents = append([]string{}, parents...)
+		config.Groups[name] = group
+	}
+
+	return config
+}
+
+// Выгрузка правил доступа в JSON
+func (ps *PrivilegesStorage) ExportJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(ps.ExportConfig())
+}
+
+// Чтение конфигурации правил доступа из JSON
+func ParsePrivilegesConfig(r io.Reader) (PrivilegesConfig, error) {
+	config := PrivilegesConfig{}
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&config)
+	return config, err
+}
+
+// Импорт правил доступа
+//
+// Возвращает список изменений, отсортированный по ключу. При dryRun изменения не применяются.
+// Повторный импорт той же конфигурации не приводит к изменениям
+func (ps *PrivilegesStorage) ImportConfig(config PrivilegesConfig, mode ImportMode, dryRun bool) ([]RuleChange, error) {
+	if mode != ImportReplace && mode != ImportMerge {
+		return nil, ErrUnvalidImportMode
+	}
+
+	rules, parents, err := config.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		next := ps.current().clone()
+		err := next.importConfig(rules, parents, mode)
+		if err != nil {
+			return nil, err
+		}
+
+		return diffPrivileges(ps.current(), next), nil
+	}
+
+	changes := []RuleChange{}
+	err = ps.commit(func(next *privilegesSnapshot) error {
+		current := ps.current()
+
+		err := next.importConfig(rules, parents, mode)
+		if err != nil {
+			return err
+		}
+
+		changes = diffPrivileges(current, next)
+		if len(changes) == 0 {
+			return errNoChanges
+		}
+
+		return nil
+	})
+	if err == errNoChanges {
+		return changes, nil
+	}
+
+	return changes, err
+}
+
+func (s *privilegesSnapshot) importConfig(rules map[string]PrivilegeType, parents map[string][]string, mode ImportMode) error {
+	if mode == ImportReplace {
+		s.rules = map[string]PrivilegeType{}
+		s.parents = map[string][]string{}
+	}
+
+	for key, mask := range rules {
+		s.rules[key] = mask
+	}
+
+	for group, items := range parents {
+		if len(items) == 0 {
+			delete(s.parents, group)
+		} else {
+			s.parents[group] = items
+		}
+	}
+
+	for group := range s.parents {
+		if hasParentsCycle(s.parents, group) {
+			return fmt.Errorf("%w: %s", ErrPrivilegesCycle, group)
+		}
+	}
+
+	// замена правил не должна закрывать модули из RestrictModule, для которых в конфигурации нет правил
+	for key, mask := range s.missingRestricted() {
+		s.rules[key] = mask
+	}
+
+	return nil
+}
+
+// Приведение конфигурации к правилам хранилища
+func (c PrivilegesConfig) decode() (map[string]PrivilegeType, map[string][]string, error) {
+	rules := map[string]PrivilegeType{}
+	parents := map[string][]string{}
+
+	add := func(subject string, modules map[string][]string) error {
+		for module, names := range modules {
+			if module == "" || strings.Contains(module, ".") {
+				return fmt.Errorf("%w: модуль %q", ErrUnvalidPermission, module)
+			}
+
+			var mask PrivilegeType
+			for _, name := range names {
+				value, err := permissionFromConfig(module, name)
+				if err != nil {
+					return err
+				}
+
+				mask |= value
+			}
+
+			rules[subject+"."+module] = mask
+		}
+
+		return nil
+	}
+
+	for name, group := range c.Groups {
+		for _, item := range append([]string{name}, group.Parents...) {
+			if item == "" || strings.Contains(item, ".") || primitive.IsValidObjectID(item) {
+				return nil, nil, fmt.Errorf("%w: %q", ErrUnvalidGroup, item)
+			}
+		}
+
+		err := add(name, group.Rules)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if group.Parents != nil {
+			parents[name] = append([]string{}, group.Parents...)
+		}
+	}
+
+	for id, user := range c.Users {
+		if !primitive.IsValidObjectID(id) {
+			return nil, nil, fmt.Errorf("%w: пользователь %q", ErrUnvalidPermission, id)
+		}
+
+		err := add(id, user.Rules)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return rules, parents, nil
+}
+
+// Сравнение правил и наследования групп двух снимков
+func diffPrivileges(before, after *privilegesSnapshot) []RuleChange {
+	changes := []RuleChange{}
+
+	add := func(key string, old, updated []string, existed, exists bool) {
+		switch {
+		case existed && !exists:
+			changes = append(changes, RuleChange{Key: key, Action: "remove", Before: old})
+		case !existed && exists:
+			changes = append(changes, RuleChange{Key: key, Action: "add", After: updated})
+		case existed && exists && strings.Join(old, ",") != strings.Join(updated, ","):
+			changes = append(changes, RuleChange{Key: key, Action: "change", Before: old, After: updated})
+		}
+	}
+
+	keys := map[string]bool{}
+	for key := range before.rules {
+		keys[key] = true
+	}
+	for key := range after.rules {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		module := strings.SplitN(key, ".", 2)[1]
+		old, existed := before.rules[key]
+		updated, exists := after.rules[key]
+		add(key, permissionConfigNames(module, old), permissionConfigNames(module, updated), existed, exists)
+	}
+
+	groups := map[string]bool{}
+	for group := range before.parents {
+		groups[group] = true
+	}
+	for group := range after.parents {
+		groups[group] = true
+	}
+
+	for group := range groups {
+		old, existed := before.parents[group]
+		updated, exists := after.parents[group]
+		add(group+".parents", old, updated, existed, exists)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// Названия прав маски, биты без названий записываются в виде bit_N
+func permissionConfigNames(module string, mask PrivilegeType) []string {
+	names, unknown := PermissionNames(module, mask)
+
+	for bit := 0; bit < 64; bit++ {
+		if unknown&(PrivilegeType(1)<<bit) != 0 {
+			names = append(names, unnamedPermissionPrefix+strconv.Itoa(bit))
+		}
+	}
+
+	return names
+}
+
+func permissionFromConfig(module, name string) (PrivilegeType, error) {
+	if strings.HasPrefix(name, unnamedPermissionPrefix) {
+		bit, err := strconv.Atoi(strings.TrimPrefix(name, unnamedPermissionPrefix))
+		if err != nil || bit < 0 || bit > PermissionLastBit {
+			return 0, fmt.Errorf("%w: %s", ErrUnvalidPermission, name)
+		}
+
+		return PrivilegeType(1) << bit, nil
+	}
+
+	mask, err := Permission(module, name)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s.%s", err, module, name)
+	}
+
+	return mask, nil
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Результат разбора проверки прав
+type Explanation struct {
+	Allowed      bool          `json:"allowed"`                 // Итог проверки, совпадает с Check
+	Requested    PrivilegeType `json:"requested"`               // Запрошенные права
+	Chain        []ExplainStep `json:"chain"`                   // Проверенные правила в порядке проверки
+	Matched      string        `json:"matched,omitempty"`       // Правило, определившее результат
+	Granted      PrivilegeType `json:"granted,omitempty"`       // Действующие временные права
+	Missing      PrivilegeType `json:"missing,omitempty"`       // Недостающие права
+	MissingNames []string      `json:"missing_names,omitempty"` // Названия недостающих прав
+}
+
+// Шаг проверки прав
+type ExplainStep struct {
+	Key     string        `json:"key"`               // Ключ правила
+	Found   bool          `json:"found"`             // Найдено ли правило
+	Mask    PrivilegeType `json:"mask"`              // Маска правила с учетом наследования
+	Sources []string      `json:"sources,omitempty"` // Правила групп, из которых собрана маска
+}
+
+// Разбор проверки прав
+//
+// Повторяет порядок проверки Check и возвращает все проверенные правила,
+// правило, определившее результат, временные права и недостающие права
+func (ps *PrivilegesStorage) Explain(id primitive.ObjectID, group, module string, privileges ...PrivilegeType) Explanation {
+	snapshot := ps.current()
+	explanation := Explanation{Chain: []ExplainStep{}}
+
+	for _, item := range privileges {
+		explanation.Requested |= item
+	}
+
+	steps := ps.explainChain(snapshot, id, group, module)
+
+	explanation.Missing = explanation.Requested
+	for _, step := range steps {
+		explanation.Chain = append(explanation.Chain, step)
+		if !step.Found {
+			continue
+		}
+
+		explanation.Matched = step.Key
+		explanation.Allowed = checkMask(step.Mask, privileges...)
+		explanation.Missing = explanation.Requested &^ step.Mask
+		break
+	}
+
+	explanation.Granted = snapshot.grantmask(id, module, time.Now())
+	if explanation.Granted != 0 {
+		explanation.Missing &^= explanation.Granted
+		explanation.Allowed = explanation.Allowed || explanation.Missing == 0
+	}
+
+	if explanation.Missing != 0 {
+		explanation.MissingNames, _ = PermissionNames(module, explanation.Missing)
+	}
+
+	return explanation
+}
+
+// Правила в порядке проверки Check
+func (ps *PrivilegesStorage) explainChain(snapshot *privilegesSnapshot, id primitive.ObjectID, group, module string) []ExplainStep {
+	if IsRestrictedModule(module) {
+		return []ExplainStep{
+			ps.explainRule(snapshot, id.Hex(), module),
+			ps.explainGroup(snapshot, group, module),
+		}
+	}
+
+	return []ExplainStep{
+		ps.explainRule(snapshot, id.Hex(), module),
+		ps.explainRule(snapshot, id.Hex(), "main"),
+		ps.explainGroup(snapshot, group, module),
+	}
+}
+
+func (ps *PrivilegesStorage) explainRule(snapshot *privilegesSnapshot, subject, module string) ExplainStep {
+	key := ps.generateKey(subject, module)
+	mask, err := ps.getmask(snapshot.rules, key)
+	return ExplainStep{Key: key, Found: err == nil, Mask: mask}
+}
+
+func (ps *PrivilegesStorage) explainGroup(snapshot *privilegesSnapshot, group, module string) ExplainStep {
+	step := ExplainStep{Key: ps.generateKey(group, module)}
+	step.Mask, step.Found = ps.effectivemask(snapshot, group, module)
+	step.Sources = ps.grouprules(snapshot, group, module)
+
+	return step
+}
+
+// Итоговые права пользователя по модулям
+//
+// Для каждого модуля, для которого заданы правила, зарегистрированы права или выданы временные права,
+// возвращает флаги всех известных в модуле прав. Маска модуля определяется в том же порядке, что и в Check:
+// первое найденное правило из цепочки пользователь и модуль, пользователь и main,
+// группа и модуль, дополненное действующими временными правами
+func (ps *PrivilegesStorage) Effective(id primitive.ObjectID, group string) map[string]map[string]bool {
+	snapshot := ps.current()
+	now := time.Now()
+
+	modules := append(ps.Modules(), PermissionModules()...)
+	for _, grant := range snapshot.grants {
+		if grant.User == id {
+			modules = append(modules, grant.Module)
+		}
+	}
+
+	result := map[string]map[string]bool{}
+	for _, module := range modules {
+		if _, ok := result[module]; ok {
+			continue
+		}
+
+		mask := snapshot.grantmask(id, module, now)
+		for _, step := range ps.explainChain(snapshot, id, group, module) {
+			if step.Found {
+				mask |= step.Mask
+				break
+			}
+		}
+
+		flags := map[string]bool{}
+		for name, value := range Permissions(module) {
+			flags[name] = mask.Check(value)
+		}
+
+		result[module] = flags
+	}
+
+	return result
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	privilegesAuditCollection = "PrivilegesAudit"
+
+	PrivilegesAuditGrant   = "grant"   // Выдача временных прав
+	PrivilegesAuditRevoke  = "revoke"  // Досрочный отзыв временных прав
+	PrivilegesAuditExpired = "expired" // Удаление истекших временных прав
+)
+
+var (
+	ErrGrantExpired = errors.New("срок действия прав уже истек")
+)
+
+// Временные права пользователя
+type Grant struct {
+	User   primitive.ObjectID `json:"user" bson:"user"`     // Пользователь
+	Module string             `json:"module" bson:"module"` // Модуль
+	Mask   PrivilegeType      `json:"mask" bson:"mask"`     // Выданные права
+	Until  time.Time          `json:"until" bson:"until"`   // Время окончания действия прав
+}
+
+// Запись журнала изменений временных прав
+type PrivilegesAuditRecord struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	Action string             `json:"action" bson:"action"`
+	Grant  Grant              `json:"grant" bson:"grant"`
+	Time   time.Time          `json:"time" bson:"time"`
+}
+
+// Выдача временных прав пользователю
+//
+// Права действуют до until и дополняют права, определенные правилами пользователя и его группы.
+// Повторная выдача с тем же сроком объединяет права, с другим сроком создает отдельную запись
+func (ps *PrivilegesStorage) GrantUser(id primitive.ObjectID, module string, until time.Time, privileges ...PrivilegeType) error {
+	if !until.After(time.Now()) {
+		return ErrGrantExpired
+	}
+
+	grant := Grant{User: id, Module: module, Until: until.UTC().Truncate(time.Millisecond)}
+	for _, item := range privileges {
+		grant.Mask |= item
+	}
+
+	err := ps.commit(func(next *privilegesSnapshot) error {
+		for i, item := range next.grants {
+			if item.User == grant.User && item.Module == grant.Module && item.Until.Equal(grant.Until) {
+				next.grants[i].Mask |= grant.Mask
+				return nil
+			}
+		}
+
+		next.grants = append(next.grants, grant)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ps.audit(PrivilegesAuditGrant, grant)
+	return nil
+}
+
+// Досрочный отзыв всех временных прав пользователя в модуле
+func (ps *PrivilegesStorage) RevokeGrants(id primitive.ObjectID, module string) error {
+	revoked := []Grant{}
+
+	err := ps.commit(func(next *privilegesSnapshot) error {
+		revoked = revoked[:0]
+		next.grants = filterGrants(next.grants, func(grant Grant) bool {
+			if grant.User == id && grant.Module == module {
+				revoked = append(revoked, grant)
+				return false
+			}
+
+			return true
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, grant := range revoked {
+		ps.audit(PrivilegesAuditRevoke, grant)
+	}
+
+	return nil
+}
+
+// Временные права пользователя, в том числе истекшие, но еще не удаленные
+func (ps *PrivilegesStorage) UserGrants(id primitive.ObjectID) []Grant {
+	return filterGrants(ps.current().grants, func(grant Grant) bool { return grant.User == id })
+}
+
+// Удаление истекших временных прав
+//
+// Каждое удаление записывается в журнал PrivilegesAudit. Возвращает удаленные права
+func (ps *PrivilegesStorage) PurgeExpiredGrants() ([]Grant, error) {
+	expired := filterGrants(ps.current().grants, func(grant Grant) bool { return !grant.Until.After(time.Now()) })
+	if len(expired) == 0 {
+		return expired, nil
+	}
+
+	err := ps.commit(func(next *privilegesSnapshot) error {
+		now := time.Now()
+		expired = expired[:0]
+
+		next.grants = filterGrants(next.grants, func(grant Grant) bool {
+			if grant.Until.After(now) {
+				return true
+			}
+
+			expired = append(expired, grant)
+			return false
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, grant := range expired {
+		ps.audit(PrivilegesAuditExpired, grant)
+	}
+
+	return expired, nil
+}
+
+// Запуск фонового удаления истекших временных прав
+//
+// Истекшие права не учитываются при проверке и без данного процесса,
+// процесс удаляет их из хранилища и записывает события в журнал.
+// Возвращает функцию для остановки процесса
+func (ps *PrivilegesStorage) StartGrantExpiry(interval time.Duration) func() {
+	stop := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, err := ps.PurgeExpiredGrants()
+				if err != nil {
+					log.Println(err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
+
+// Журнал изменений временных прав пользователя
+func (ps *PrivilegesStorage) GrantsAuditLog(id primitive.ObjectID) ([]PrivilegesAuditRecord, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+	defer cancel()
+
+	records := []PrivilegesAuditRecord{}
+
+	cur, err := DB().Collection(privilegesAuditCollection).Find(ctx, bson.D{{Key: "grant.user", Value: id}})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cur.All(ctx, &records)
+	return records, err
+}
+
+// Маска действующих временных прав пользователя в модуле
+func (s *privilegesSnapshot) grantmask(id primitive.ObjectID, module string, now time.Time) PrivilegeType {
+	var mask PrivilegeType
+
+	for _, grant := range s.grants {
+		if grant.User == id && grant.Module == module && grant.Until.After(now) {
+			mask |= grant.Mask
+		}
+	}
+
+	return mask
+}
+
+// Запись события в журнал, если хранилище связано с базой данных
+func (ps *PrivilegesStorage) audit(action string, grant Grant) {
+	log.Printf("временные права %s: пользователь %s, модуль %s, права %d, до %s",
+		action, grant.User.Hex(), grant.Module, grant.Mask, grant.Until.Format(time.RFC3339))
+
+	if !ps.current().loaded {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+	defer cancel()
+
+	_, err := DB().Collection(privilegesAuditCollection).InsertOne(ctx, PrivilegesAuditRecord{
+		ID:     primitive.NewObjectID(),
+		Action: action,
+		Grant:  grant,
+		Time:   time.Now(),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func filterGrants(grants []Grant, keep func(Grant) bool) []Grant {
+	result := []Grant{}
+	for _, grant := range grants {
+		if keep(grant) {
+			result = append(result, grant)
+		}
+	}
+
+	return result
+}
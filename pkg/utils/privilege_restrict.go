@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	restrictedModules      = map[string]map[string]PrivilegeType{}
+	restrictedModulesMutex sync.RWMutex
+)
+
+// Отключение подстановки правил main для модуля
+//
+// Для модуля проверяются только его собственные правила, поэтому права main
+// (например PublicWrite, которое выдается для создания материалов от имени других пользователей)
+// не открывают доступ к модулю. Используется для административных модулей.
+//
+// defaults - правила групп модуля, которые добавляются, если для модуля нет ни одного правила,
+// в том числе после загрузки правил из базы данных. Чтобы закрыть модуль для всех,
+// достаточно оставить правило с пустой маской
+func RestrictModule(module string, defaults map[string]PrivilegeType) error {
+	restrictedModulesMutex.Lock()
+	restrictedModules[module] = defaults
+	restrictedModulesMutex.Unlock()
+
+	return Privileges().ensureRestricted()
+}
+
+// Проверка, что для модуля отключена подстановка правил main
+func IsRestrictedModule(module string) bool {
+	restrictedModulesMutex.RLock()
+	defer restrictedModulesMutex.RUnlock()
+
+	_, ok := restrictedModules[module]
+	return ok
+}
+
+// Правила по умолчанию для модулей без подстановки main, для которых нет ни одного правила
+func (s *privilegesSnapshot) missingRestricted() map[string]PrivilegeType {
+	restrictedModulesMutex.RLock()
+	defer restrictedModulesMutex.RUnlock()
+
+	configured := map[string]bool{}
+	for key := range s.rules {
+		if parts := strings.SplitN(key, ".", 2); len(parts) == 2 {
+			configured[parts[1]] = true
+		}
+	}
+
+	missing := map[string]PrivilegeType{}
+	for module, defaults := range restrictedModules {
+		if configured[module] {
+			continue
+		}
+
+		for group, mask := range defaults {
+			missing[group+"."+module] = mask
+		}
+	}
+
+	return missing
+}
+
+// Добавление отсутствующих правил для модулей без подстановки main
+func (ps *PrivilegesStorage) ensureRestricted() error {
+	if len(ps.current().missingRestricted()) == 0 {
+		return nil
+	}
+
+	err := ps.commit(func(next *privilegesSnapshot) error {
+		missing := next.missingRestricted()
+		if len(missing) == 0 {
+			return errNoChanges
+		}
+
+		for key, mask := range missing {
+			next.rules[key] = mask
+		}
+
+		return nil
+	})
+	if err == errNoChanges {
+		return nil
+	}
+
+	return err
+}
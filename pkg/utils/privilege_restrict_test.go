@@ -0,0 +1,73 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_RestrictModule(t *testing.T) {
+	err := utils.RestrictModule("restricted", map[string]utils.PrivilegeType{"admin": utils.PublicWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { utils.UnrestrictModule("restricted") })
+
+	storage := utils.NewPrivilegesStorage()
+	id := primitive.NewObjectID()
+
+	err = storage.SetGroup("user", "main", utils.PublicWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if storage.Check(id, "user", "restricted", utils.PublicWrite) {
+		t.Error("право main открыло доступ к модулю без подстановки main")
+	}
+
+	if storage.Explain(id, "user", "restricted", utils.PublicWrite).Allowed {
+		t.Error("разбор проверки разрешает доступ к модулю без подстановки main")
+	}
+
+	if !storage.Check(id, "user", "blog", utils.PublicWrite) {
+		t.Error("право main должно применяться к обычным модулям")
+	}
+
+	if !storage.Check(id, "admin", "restricted", utils.PublicWrite) {
+		t.Error("правило по умолчанию для группы admin не добавлено")
+	}
+}
+
+func Test_ImportReplaceKeepsRestrictedModules(t *testing.T) {
+	err := utils.RestrictModule("import_restricted", map[string]utils.PrivilegeType{"admin": utils.PublicWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { utils.UnrestrictModule("import_restricted") })
+
+	storage := utils.NewPrivilegesStorage()
+	config := utils.PrivilegesConfig{Groups: map[string]utils.GroupConfig{
+		"admin": {Rules: map[string][]string{"main": {"public_write"}}},
+	}}
+
+	changes, err := storage.ImportConfig(config, utils.ImportReplace, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, change := range changes {
+		if change.Key == "admin.import_restricted" {
+			t.Errorf("пробный импорт удаляет правило модуля без подстановки main: %+v", change)
+		}
+	}
+
+	_, err = storage.ImportConfig(config, utils.ImportReplace, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !storage.Check(primitive.NewObjectID(), "admin", "import_restricted", utils.PublicWrite) {
+		t.Error("замена правил закрыла модуль без подстановки main для группы admin")
+	}
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrPrivilegesCycle = errors.New("наследование групп образует цикл")
+	ErrUnvalidGroup    = errors.New("некорректное название группы")
+)
+
+// Установка родительских групп
+//
+// Группа наследует правила всех родительских групп, в том числе правила модулей.
+// Собственные правила группы дополняют унаследованные.
+// Вызов без родителей удаляет наследование для группы
+func (ps *PrivilegesStorage) SetParents(group string, parents ...string) error {
+	for _, name := range append([]string{group}, parents...) {
+		if name == "" || strings.Contains(name, ".") {
+			return ErrUnvalidGroup
+		}
+	}
+
+	return ps.commit(func(next *privilegesSnapshot) error {
+		if len(parents) == 0 {
+			delete(next.parents, group)
+			return nil
+		}
+
+		next.parents[group] = append([]string{}, parents...)
+
+		if hasParentsCycle(next.parents, group) {
+			return ErrPrivilegesCycle
+		}
+
+		return nil
+	})
+}
+
+// Родительские группы
+func (ps *PrivilegesStorage) Parents(group string) []string {
+	return append([]string{}, ps.current().parents[group]...)
+}
+
+// Группа и все ее предки в порядке обхода в ширину
+func (ps *PrivilegesStorage) Ancestors(group string) []string {
+	return ancestors(ps.current().parents, group)
+}
+
+// Итоговая маска группы для модуля с учетом наследования
+//
+// Группы цепочки без правила модуля добавляют свое правило main (кроме модулей из RestrictModule)
+func (ps *PrivilegesStorage) EffectiveMask(group, module string) PrivilegeType {
+	mask, _ := ps.effectivemask(ps.current(), group, module)
+	return mask
+}
+
+// Проверка, что группа group получает все права группы other
+//
+// Сравниваются итоговые маски групп во всех модулях, для которых заданы правила
+func (ps *PrivilegesStorage) Covers(group, other string) bool {
+	snapshot := ps.current()
+
+	for _, module := range ps.Modules() {
+		mask, _ := ps.effectivemask(snapshot, group, module)
+		otherMask, _ := ps.effectivemask(snapshot, other, module)
+
+		if otherMask&^mask != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Объединение масок группы и ее предков для модуля
+//
+// Второе значение сообщает, найдено ли хотя бы одно правило
+func (ps *PrivilegesStorage) effectivemask(snapshot *privilegesSnapshot, group, module string) (PrivilegeType, bool) {
+	keys := ps.grouprules(snapshot, group, module)
+
+	var mask PrivilegeType
+	for _, key := range keys {
+		mask |= snapshot.rules[key]
+	}
+
+	return mask, len(keys) != 0
+}
+
+// Правила, из которых собирается маска группы для модуля
+//
+// Каждая группа цепочки добавляет свое правило модуля, а если его нет - свое правило main,
+// поэтому правило модуля, заданное для родителя, не сужает права, которые группа получает
+// по собственным правилам
+func (ps *PrivilegesStorage) grouprules(snapshot *privilegesSnapshot, group, module string) []string {
+	fallback := module != "main" && !IsRestrictedModule(module)
+	keys := []string{}
+
+	for _, name := range ancestors(snapshot.parents, group) {
+		key := ps.generateKey(name, module)
+		if _, ok := snapshot.rules[key]; !ok && fallback {
+			key = ps.generateKey(name, "main")
+		}
+
+		if _, ok := snapshot.rules[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Обход групп с защитой от циклов, которые могли попасть в базу данных в обход SetParents
+func ancestors(parents map[string][]string, group string) []string {
+	result := []string{group}
+	visited := map[string]bool{group: true}
+
+	for i := 0; i < len(result); i++ {
+		for _, parent := range parents[result[i]] {
+			if visited[parent] {
+				continue
+			}
+
+			visited[parent] = true
+			result = append(result, parent)
+		}
+	}
+
+	return result
+}
+
+// Проверка, достижима ли группа из своих родителей
+func hasParentsCycle(parents map[string][]string, group string) bool {
+	stack := append([]string{}, parents[group]...)
+	visited := map[string]bool{}
+
+	for len(stack) > 0 {
+		name := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if name == group {
+			return true
+		}
+
+		if visited[name] {
+			continue
+		}
+
+		visited[name] = true
+		stack = append(stack, parents[name]...)
+	}
+
+	return false
+}
@@ -0,0 +1,310 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrPrivilegesConflict = errors.New("правила доступа были изменены другим экземпляром приложения")
+
+	// Интервал проверки изменений правил доступа в базе данных
+	PrivilegesSyncInterval = time.Second * 5
+	// Максимальный интервал между попытками синхронизации при ошибках
+	PrivilegesSyncMaxBackoff = time.Minute
+
+	privilegesCommitAttempts = 5
+)
+
+// Документ правил доступа в системной коллекции
+//
+// Правила хранятся списком, так как ключи правил содержат точку
+type privilegesDocument struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Rules     []privilegeRule    `bson:"rules"`
+	Groups    []privilegeGroup   `bson:"groups"`
+	Grants    []Grant            `bson:"grants"`
+	Version   int64              `bson:"version"`
+	Timestamp time.Time          `bson:"time"`
+}
+
+type privilegeRule struct {
+	Key  string        `bson:"key"`
+	Mask PrivilegeType `bson:"mask"`
+}
+
+type privilegeGroup struct {
+	Name    string   `bson:"name"`
+	Parents []string `bson:"parents"`
+}
+
+// Загрузка правил доступа из базы данных
+//
+// Если документ с правилами отсутствует, в базу записываются правила по умолчанию,
+// отсутствующие правила модулей из RestrictModule дописываются в документ.
+// После загрузки все изменения правил сохраняются в базу данных
+func (ps *PrivilegesStorage) Load() error {
+	ps.mutex.Lock()
+	err := ps.load()
+	ps.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return ps.ensureRestricted()
+}
+
+func (ps *PrivilegesStorage) load() error {
+	doc, err := ps.fetch()
+	if err == mongo.ErrNoDocuments {
+		err = ps.seed()
+		if err != nil {
+			return err
+		}
+
+		doc, err = ps.fetch()
+	}
+	if err != nil {
+		return err
+	}
+
+	policies, err := ps.fetchPolicies()
+	if err != nil {
+		return err
+	}
+
+	ps.apply(doc, policies)
+	return nil
+}
+
+// Включение синхронизации правил доступа
+//
+// Каждые PrivilegesSyncInterval проверяет версию документа в базе данных
+// и загружает правила, если они были изменены другим экземпляром приложения.
+// При ошибках интервал увеличивается вдвое, но не более PrivilegesSyncMaxBackoff
+func (ps *PrivilegesStorage) Sync() {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if ps.stop != nil {
+		return
+	}
+
+	ps.stop = make(chan struct{})
+	go ps.autoupdate(ps.stop)
+}
+
+// Отключение синхронизации правил доступа
+func (ps *PrivilegesStorage) Unsync() {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if ps.stop == nil {
+		return
+	}
+
+	close(ps.stop)
+	ps.stop = nil
+}
+
+func (ps *PrivilegesStorage) autoupdate(stop chan struct{}) {
+	delay := PrivilegesSyncInterval
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+
+		err := ps.refresh()
+		if err != nil {
+			log.Println(err)
+
+			delay *= 2
+			if delay > PrivilegesSyncMaxBackoff {
+				delay = PrivilegesSyncMaxBackoff
+			}
+
+			continue
+		}
+
+		delay = PrivilegesSyncInterval
+	}
+}
+
+// Загрузка правил, если версия в базе данных новее локальной
+func (ps *PrivilegesStorage) refresh() error {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+	defer cancel()
+
+	count, err := DB().Collection(systemCollection).CountDocuments(ctx, bson.D{
+		{Key: "_id", Value: ps.ID},
+		{Key: "version", Value: bson.D{{Key: "$gt", Value: ps.Version()}}},
+	})
+	if err != nil || count == 0 {
+		return err
+	}
+
+	return ps.Load()
+}
+
+// Применение изменения к правилам доступа
+//
+// Изменение применяется к копии правил. Если правила загружены из базы данных,
+// копия сохраняется с проверкой версии документа. При конфликте правила загружаются заново
+// и изменение применяется повторно
+//
+// Блокировка удерживается на время запроса к базе данных и повторной загрузки, чтобы изменения
+// одного экземпляра приложения сохранялись последовательно и не вызывали конфликтов версий друг у друга.
+// Проверки прав читают снимок правил без блокировки и не ожидают сохранения,
+// ожидают только другие изменения, Load, Sync и Unsync (не дольше таймаутов запросов)
+//
+// Ошибка, возвращенная change, прерывает изменение
+func (ps *PrivilegesStorage) commit(change func(next *privilegesSnapshot) error) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	for attempt := 0; attempt < privilegesCommitAttempts; attempt++ {
+		snapshot := ps.current()
+		next := snapshot.clone()
+
+		err := change(next)
+		if err != nil {
+			return err
+		}
+
+		if !snapshot.loaded {
+			next.timestamp = time.Now()
+			ps.snapshot.Store(next)
+			return nil
+		}
+
+		saved, err := ps.save(snapshot.version, next)
+		if err != nil {
+			return err
+		}
+
+		if saved {
+			return nil
+		}
+
+		err = ps.load()
+		if err != nil {
+			return err
+		}
+	}
+
+	return ErrPrivilegesConflict
+}
+
+// Сохранение правил, если версия документа в базе данных совпадает с локальной
+func (ps *PrivilegesStorage) save(version int64, next *privilegesSnapshot) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+	defer cancel()
+
+	doc := encodePrivileges(next)
+	doc.ID = ps.ID
+	doc.Version = version + 1
+	doc.Timestamp = time.Now()
+
+	res, err := DB().Collection(systemCollection).UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: ps.ID},
+		{Key: "version", Value: version},
+	}, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "rules", Value: doc.Rules},
+			{Key: "groups", Value: doc.Groups},
+			{Key: "grants", Value: doc.Grants},
+			{Key: "version", Value: doc.Version},
+			{Key: "time", Value: doc.Timestamp},
+		}},
+	})
+	if err != nil || res.MatchedCount == 0 {
+		return false, err
+	}
+
+	ps.apply(doc, next.policies)
+	return true, nil
+}
+
+// Запись правил по умолчанию, если документ с правилами отсутствует
+func (ps *PrivilegesStorage) seed() error {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+	defer cancel()
+
+	doc := encodePrivileges(defaultPrivileges())
+
+	_, err := DB().Collection(systemCollection).UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: ps.ID},
+	}, bson.D{
+		{Key: "$setOnInsert", Value: bson.D{
+			{Key: "rules", Value: doc.Rules},
+			{Key: "groups", Value: doc.Groups},
+			{Key: "version", Value: int64(1)},
+			{Key: "time", Value: time.Now()},
+		}},
+	}, options.Update().SetUpsert(true))
+
+	return err
+}
+
+func (ps *PrivilegesStorage) fetch() (privilegesDocument, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*3)
+	defer cancel()
+
+	doc := privilegesDocument{}
+	err := DB().Collection(systemCollection).FindOne(ctx, bson.D{{Key: "_id", Value: ps.ID}}).Decode(&doc)
+	return doc, err
+}
+
+func (ps *PrivilegesStorage) apply(doc privilegesDocument, policies map[string][]Policy) {
+	rules := make(map[string]PrivilegeType, len(doc.Rules))
+	for _, item := range doc.Rules {
+		rules[item.Key] = item.Mask
+	}
+
+	parents := make(map[string][]string, len(doc.Groups))
+	for _, item := range doc.Groups {
+		parents[item.Name] = item.Parents
+	}
+
+	ps.snapshot.Store(&privilegesSnapshot{
+		rules:     rules,
+		parents:   parents,
+		policies:  policies,
+		grants:    doc.Grants,
+		version:   doc.Version,
+		timestamp: doc.Timestamp,
+		loaded:    true,
+	})
+}
+
+func encodePrivileges(snapshot *privilegesSnapshot) privilegesDocument {
+	doc := privilegesDocument{
+		Rules:  make([]privilegeRule, 0, len(snapshot.rules)),
+		Groups: make([]privilegeGroup, 0, len(snapshot.parents)),
+		Grants: append([]Grant{}, snapshot.grants...),
+	}
+
+	for key, value := range snapshot.rules {
+		doc.Rules = append(doc.Rules, privilegeRule{Key: key, Mask: value})
+	}
+
+	for name, parents := range snapshot.parents {
+		doc.Groups = append(doc.Groups, privilegeGroup{Name: name, Parents: parents})
+	}
+
+	sort.Slice(doc.Rules, func(i, j int) bool { return doc.Rules[i].Key < doc.Rules[j].Key })
+	sort.Slice(doc.Groups, func(i, j int) bool { return doc.Groups[i].Name < doc.Groups[j].Name })
+	return doc
+}
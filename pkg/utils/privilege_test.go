@@ -0,0 +1,397 @@
+package utils_test
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ReanSn0w/gobase/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_PrivilegeTypeCheck(t *testing.T) {
+	pt := utils.OwnerRead
+	pt.Set(utils.PublicRead)
+
+	if !pt.Check(utils.PublicRead) || !pt.Check(utils.OwnerRead) {
+		t.Errorf("установленные права не найдены в маске %d", pt)
+	}
+
+	if pt.Check(utils.OwnerWrite) {
+		t.Errorf("маска %d содержит не установленное право", pt)
+	}
+
+	pt.Unset(utils.OwnerRead)
+	if pt != utils.PublicRead {
+		t.Errorf("ожидалась маска %d, получено %d", utils.PublicRead, pt)
+	}
+}
+
+func Test_PrivilegeTypeCombinedMask(t *testing.T) {
+	pt := utils.OwnerRead
+	pt.Set(utils.OwnerRead | utils.PublicUpdate)
+
+	if pt != utils.OwnerRead|utils.PublicUpdate {
+		t.Errorf("ожидалась маска %d, получено %d", utils.OwnerRead|utils.PublicUpdate, pt)
+	}
+
+	pt.Unset(utils.PublicUpdate | utils.PublicDelete)
+	if pt != utils.OwnerRead {
+		t.Errorf("ожидалась маска %d, получено %d", utils.OwnerRead, pt)
+	}
+}
+
+func Test_PrivilegesDefaults(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+	owner := utils.OwnerRead | utils.OwnerWrite | utils.OwnerUpdate | utils.OwnerDelete
+
+	// итоговые права групп с учетом наследования совпадают с прежним плоским списком правил,
+	// право PublicDelete по умолчанию не выдается ни одной группе
+	expected := map[string]utils.PrivilegeType{
+		"guest":     utils.PublicRead,
+		"banned":    utils.PublicRead | utils.OwnerRead,
+		"user":      owner | utils.PublicRead,
+		"moderator": owner | utils.PublicRead | utils.PublicUpdate,
+		"admin":     owner | utils.PublicRead | utils.PublicWrite | utils.PublicUpdate,
+	}
+
+	for group, mask := range expected {
+		if value := storage.EffectiveMask(group, "main"); value != mask {
+			t.Errorf("группа %s: ожидалась маска %d, получено %d", group, mask, value)
+		}
+	}
+}
+
+func Test_PrivilegesConcurrentAccess(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+	id := primitive.NewObjectID()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				storage.Check(id, "race", "main", utils.OwnerRead)
+				storage.Check(id, "user", "race", utils.OwnerRead)
+				storage.Groups()
+			}
+		}()
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				err := storage.SetGroup("race", "main", utils.OwnerRead, utils.PrivilegeType(1<<(i%4+4)))
+				if err != nil {
+					t.Error(err)
+				}
+
+				err = storage.SetUser(id, "race", utils.OwnerWrite)
+				if err != nil {
+					t.Error(err)
+				}
+
+				err = storage.UnsetUser(id, "race", utils.OwnerWrite)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if !storage.Check(id, "race", "main", utils.OwnerRead, utils.PublicRead, utils.PublicDelete) {
+		t.Errorf("изменения правил потеряны: %d", storage.Rules()["race.main"])
+	}
+
+	err := storage.RemoveUser(id)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, ok := storage.Rules()[id.Hex()+".race"]; ok {
+		t.Error("персональные правила пользователя не удалены")
+	}
+}
+
+func Test_PrivilegesInheritance(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+	id := primitive.NewObjectID()
+
+	if !storage.Check(id, "admin", "main", utils.OwnerRead, utils.PublicUpdate, utils.PublicWrite) {
+		t.Error("группа admin должна наследовать права moderator и user")
+	}
+
+	err := storage.SetGroup("user", "inherit", utils.OwnerRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if storage.Check(id, "user", "inherit", utils.PublicRead) {
+		t.Error("правило модуля должно иметь приоритет над main группы")
+	}
+
+	if !storage.Check(id, "admin", "inherit", utils.OwnerRead, utils.PublicUpdate, utils.PublicWrite) {
+		t.Error("правило модуля родителя не должно сужать права, заданные правилами main наследников")
+	}
+
+	err = storage.SetParents("user", "admin")
+	if err != utils.ErrPrivilegesCycle {
+		t.Errorf("ожидалась ошибка %v, получено %v", utils.ErrPrivilegesCycle, err)
+	}
+
+	if len(storage.Parents("user")) != 0 {
+		t.Error("цикл наследования сохранен")
+	}
+}
+
+func Test_PrivilegesExplain(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+	id := primitive.NewObjectID()
+
+	err := storage.SetGroup("user", "explain", utils.OwnerRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explanation := storage.Explain(id, "moderator", "explain", utils.OwnerRead, utils.OwnerWrite, utils.PublicUpdate)
+	if explanation.Allowed != storage.Check(id, "moderator", "explain", utils.OwnerRead, utils.OwnerWrite, utils.PublicUpdate) {
+		t.Error("результат разбора не совпадает с Check")
+	}
+
+	if explanation.Matched != "moderator.explain" || explanation.Missing != utils.OwnerWrite {
+		t.Errorf("неверный разбор: %+v", explanation)
+	}
+
+	sources := explanation.Chain[len(explanation.Chain)-1].Sources
+	if len(explanation.Chain) != 3 || len(sources) != 2 || sources[0] != "moderator.main" || sources[1] != "user.explain" {
+		t.Errorf("неверная цепочка правил: %+v", explanation.Chain)
+	}
+
+	if len(explanation.MissingNames) != 1 || explanation.MissingNames[0] != "owner_write" {
+		t.Errorf("неверные названия недостающих прав: %v", explanation.MissingNames)
+	}
+}
+
+func Test_PrivilegesGrants(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+	id := primitive.NewObjectID()
+
+	err := storage.GrantUser(id, "event", time.Now().Add(-time.Minute), utils.PublicUpdate)
+	if err != utils.ErrGrantExpired {
+		t.Errorf("ожидалась ошибка %v, получено %v", utils.ErrGrantExpired, err)
+	}
+
+	err = storage.GrantUser(id, "event", time.Now().Add(time.Hour), utils.PublicUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !storage.Check(id, "user", "event", utils.OwnerRead|utils.PublicUpdate) {
+		t.Error("временные права должны дополнять права группы")
+	}
+
+	if storage.Check(primitive.NewObjectID(), "user", "event", utils.PublicUpdate) {
+		t.Error("временные права выданы другому пользователю")
+	}
+
+	if explanation := storage.Explain(id, "user", "event", utils.PublicUpdate); !explanation.Allowed || explanation.Granted != utils.PublicUpdate {
+		t.Errorf("временные права не учтены в разборе: %+v", explanation)
+	}
+
+	err = storage.GrantUser(id, "event", time.Now().Add(time.Millisecond*10), utils.PublicDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+
+	if storage.Check(id, "user", "event", utils.PublicDelete) {
+		t.Error("истекшие временные права учтены при проверке")
+	}
+
+	expired, err := storage.PurgeExpiredGrants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(expired) != 1 || len(storage.UserGrants(id)) != 1 {
+		t.Errorf("неверное удаление истекших прав: %v, осталось %v", expired, storage.UserGrants(id))
+	}
+
+	err = storage.RevokeGrants(id, "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if storage.Check(id, "user", "event", utils.PublicUpdate) {
+		t.Error("отозванные временные права учтены при проверке")
+	}
+}
+
+func Test_PrivilegesConfig(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+
+	buffer := bytes.Buffer{}
+	err := storage.ExportJSON(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := utils.ParsePrivilegesConfig(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := storage.ImportConfig(config, utils.ImportReplace, true)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("повторный импорт выгрузки не должен менять правила: %v, %v", changes, err)
+	}
+
+	merge := utils.PrivilegesConfig{Groups: map[string]utils.GroupConfig{
+		"editor": {Parents: []string{"user"}, Rules: map[string][]string{"config": {"public_update", "bit_40"}}},
+	}}
+
+	changes, err = storage.ImportConfig(merge, utils.ImportMerge, true)
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("неверный список изменений: %v, %v", changes, err)
+	}
+
+	if storage.HasGroup("editor") {
+		t.Error("пробный импорт изменил правила")
+	}
+
+	_, err = storage.ImportConfig(merge, utils.ImportMerge, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !storage.Check(primitive.NewObjectID(), "editor", "config", utils.PublicUpdate, 1<<40) {
+		t.Error("импортированные правила не применены")
+	}
+
+	changes, err = storage.ImportConfig(merge, utils.ImportMerge, false)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("повторный импорт не должен менять правила: %v, %v", changes, err)
+	}
+
+	_, err = storage.ImportConfig(utils.PrivilegesConfig{Groups: map[string]utils.GroupConfig{
+		"user": {Rules: map[string][]string{"config": {"unknown"}}},
+	}}, utils.ImportMerge, false)
+	if !errors.Is(err, utils.ErrUnknownPermission) {
+		t.Errorf("ожидалась ошибка %v, получено %v", utils.ErrUnknownPermission, err)
+	}
+}
+
+func Test_PrivilegesEffective(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+	id := primitive.NewObjectID()
+
+	err := storage.SetUser(id, "effective", utils.OwnerRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	effective := storage.Effective(id, "admin")
+
+	if !effective["main"]["public_write"] || effective["effective"]["public_write"] {
+		t.Errorf("неверный порядок правил: %v", effective)
+	}
+
+	for module, flags := range effective {
+		for name, allowed := range flags {
+			mask, _ := utils.Permission(module, name)
+			if storage.Check(id, "admin", module, mask) != allowed {
+				t.Errorf("%s.%s не совпадает с Check", module, name)
+			}
+		}
+	}
+}
+
+func Test_PrivilegesExtendUserKeepsGroupRights(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+	id := primitive.NewObjectID()
+
+	err := storage.ExtendUser(id, "user", "extend", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !storage.Check(id, "user", "extend", 1<<20, utils.OwnerWrite, utils.PublicRead) {
+		t.Errorf("выдача права отменила права группы: %d", storage.UserRules(id)["extend"])
+	}
+
+	if storage.Check(id, "user", "extend", utils.PublicUpdate) {
+		t.Error("выданы права, которых нет у группы")
+	}
+}
+
+func Test_PrivilegesReduceUserWithoutRule(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+	id := primitive.NewObjectID()
+
+	err := storage.ReduceUser(id, "reduce", utils.PublicRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := storage.UserRules(id)["reduce"]; ok {
+		t.Error("отзыв прав создал персональное правило")
+	}
+
+	if !storage.Check(id, "user", "reduce", utils.OwnerRead, utils.PublicRead) {
+		t.Error("отзыв прав без персонального правила изменил права пользователя")
+	}
+}
+
+func Test_PrivilegesReduceUserRemovesEmptyRule(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+	id := primitive.NewObjectID()
+
+	err := storage.SetUser(id, "reduce", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.ReduceUser(id, "reduce", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := storage.UserRules(id)["reduce"]; ok {
+		t.Error("пустое персональное правило не удалено")
+	}
+
+	if !storage.Check(id, "user", "reduce", utils.OwnerRead) {
+		t.Error("после удаления персонального правила не применяются правила группы")
+	}
+}
+
+func Test_PrivilegesCovers(t *testing.T) {
+	storage := utils.NewPrivilegesStorage()
+
+	for _, group := range []string{"guest", "banned", "user", "moderator", "admin"} {
+		if !storage.Covers("admin", group) {
+			t.Errorf("группа admin должна иметь все права группы %s", group)
+		}
+	}
+
+	if storage.Covers("moderator", "admin") {
+		t.Error("группа moderator не должна иметь все права группы admin")
+	}
+
+	err := storage.SetGroup("support", "covers", utils.PublicDelete)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if storage.Covers("admin", "support") {
+		t.Error("не учтены права группы в модуле")
+	}
+}